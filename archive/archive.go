@@ -0,0 +1,251 @@
+package archive
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"gopod/config"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	INDEX_FILE = "index.xml"
+
+	// DIR_FORMAT moves the episodes into a directory per channel, TAR_FORMAT writes them to a
+	// compressed tarball per channel and archive run.
+	DIR_FORMAT = "dir"
+	TAR_FORMAT = "tar.gz"
+)
+
+// Archive is a directory that expired episodes are moved to instead of being deleted.  The
+// index of the archive lists where each episode can be found.
+type Archive struct {
+	dir    string
+	format string
+	index  *Index
+	dirty  bool
+	// opened names the tarballs written by this archive run
+	opened time.Time
+}
+
+// Open reads the index of the archive in dir.  Nothing is written to dir until episodes
+// are added.
+func Open(dir, format string) (*Archive, error) {
+	if format == "" {
+		format = DIR_FORMAT
+	}
+	if format != DIR_FORMAT && format != TAR_FORMAT {
+		return nil, fmt.Errorf("Unknown archive format %q, expected %q or %q", format, DIR_FORMAT, TAR_FORMAT)
+	}
+
+	index := &Index{}
+	indexFile, err := os.Open(filepath.Join(dir, INDEX_FILE))
+	if err == nil {
+		defer indexFile.Close()
+		if index, err = ParseIndex(indexFile); err != nil {
+			return nil, fmt.Errorf("Unable to parse the archive index %s: %v", indexFile.Name(), err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return &Archive{dir: dir, format: format, index: index, opened: time.Now()}, nil
+}
+
+// Destination returns the path that file of channel is archived to, the tarball of the
+// channel for this archive run for TAR_FORMAT.
+func (archive *Archive) Destination(channel, file string) string {
+	if archive.format == TAR_FORMAT {
+		return filepath.Join(archive.dir, channel+"-"+archive.opened.Format("20060102-150405")+"."+TAR_FORMAT)
+	}
+	return filepath.Join(archive.dir, channel, filepath.Base(file))
+}
+
+// Add archives the files of the entries of channel and removes them.  The entries that
+// were archived are recorded in the index and returned, for TAR_FORMAT either all or none
+// of them are archived to a new tarball.
+func (archive *Archive) Add(channel string, entries []Entry) (archived []Entry, err error) {
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	if archive.format == TAR_FORMAT {
+		archived, err = archive.addToTarball(channel, entries)
+	} else {
+		archived, err = archive.moveToDir(channel, entries)
+	}
+
+	now := time.Now().Format(time.RFC3339)
+	for i := range archived {
+		archived[i].Archived = now
+	}
+	if len(archived) > 0 {
+		archive.index.Entries = append(archive.index.Entries, archived...)
+		archive.dirty = true
+	}
+
+	return archived, err
+}
+
+// Close writes the index if episodes have been added.
+func (archive *Archive) Close() error {
+	if !archive.dirty {
+		return nil
+	}
+
+	err := config.WriteFileAtomically(filepath.Join(archive.dir, INDEX_FILE), func(file io.Writer) error {
+		_, err := archive.index.Write(file)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("Unable to write the archive index: %v", err)
+	}
+
+	archive.dirty = false
+	return nil
+}
+
+func (archive *Archive) moveToDir(channel string, entries []Entry) (archived []Entry, err error) {
+	channelDir := filepath.Join(archive.dir, channel)
+	if err := os.MkdirAll(channelDir, 0755); err != nil {
+		return nil, fmt.Errorf("Unable to create archive directory %q: %v", channelDir, err)
+	}
+
+	for _, entry := range entries {
+		destination := uniquePath(archive.Destination(channel, entry.File), exists)
+		if moveErr := moveFile(entry.File, destination); moveErr != nil {
+			if err == nil {
+				err = fmt.Errorf("Unable to archive %s: %v", entry.File, moveErr)
+			}
+			continue
+		}
+		entry.Archive = destination
+		archived = append(archived, entry)
+	}
+
+	return archived, err
+}
+
+// addToTarball writes the files of the entries to a new tarball so that archiving never
+// reads or rewrites the tarballs of earlier runs.
+func (archive *Archive) addToTarball(channel string, entries []Entry) ([]Entry, error) {
+	if err := os.MkdirAll(archive.dir, 0755); err != nil {
+		return nil, fmt.Errorf("Unable to create archive directory %q: %v", archive.dir, err)
+	}
+
+	tarball := archive.Destination(channel, "")
+	base := strings.TrimSuffix(tarball, "."+TAR_FORMAT)
+	for n := 2; exists(tarball); n++ {
+		tarball = fmt.Sprintf("%s-%d.%s", base, n, TAR_FORMAT)
+	}
+
+	members := make([]string, len(entries))
+	err := config.WriteFileAtomically(tarball, func(file io.Writer) error {
+		gzipWriter := gzip.NewWriter(file)
+		tarWriter := tar.NewWriter(gzipWriter)
+
+		names := map[string]bool{}
+		for i, entry := range entries {
+			members[i] = uniquePath(filepath.Base(entry.File), func(name string) bool { return names[name] })
+			names[members[i]] = true
+			if err := addTarMember(tarWriter, entry.File, members[i]); err != nil {
+				return err
+			}
+		}
+
+		if err := tarWriter.Close(); err != nil {
+			return err
+		}
+		return gzipWriter.Close()
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to archive to %s: %v", tarball, err)
+	}
+
+	archived := make([]Entry, len(entries))
+	for i, entry := range entries {
+		entry.Archive = tarball
+		entry.Member = members[i]
+		archived[i] = entry
+		if err := os.Remove(entry.File); err != nil {
+			log.Printf("Unable to delete archived podcast: %v\n", err)
+		}
+	}
+	return archived, nil
+}
+
+func addTarMember(tarWriter *tar.Writer, path, name string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	header.Name = name
+
+	if err := tarWriter.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err = io.Copy(tarWriter, file)
+	return err
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// uniquePath returns path or, if it is taken, path with " (n)" inserted before the
+// extension.
+func uniquePath(path string, taken func(string) bool) string {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	unique := path
+	for n := 2; taken(unique); n++ {
+		unique = fmt.Sprintf("%s (%d)%s", base, n, ext)
+	}
+	return unique
+}
+
+// moveFile renames source to destination and falls back to copying it for destinations on
+// a different file system.
+func moveFile(source, destination string) error {
+	if err := os.Rename(source, destination); err == nil {
+		return nil
+	}
+
+	sourceFile, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer sourceFile.Close()
+
+	destinationFile, err := os.OpenFile(destination, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(destinationFile, sourceFile); err != nil {
+		destinationFile.Close()
+		os.Remove(destination)
+		return err
+	}
+	if err := destinationFile.Close(); err != nil {
+		os.Remove(destination)
+		return err
+	}
+
+	return os.Remove(source)
+}
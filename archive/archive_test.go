@@ -0,0 +1,171 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func episodeFiles(t *testing.T, dir string, names ...string) []Entry {
+	entries := []Entry{}
+	for _, name := range names {
+		file := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(file, []byte("episode "+name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, Entry{XmlUrl: "http://url0", Guid: name, File: file})
+	}
+	return entries
+}
+
+func readIndex(t *testing.T, dir string) *Index {
+	file, err := os.Open(filepath.Join(dir, INDEX_FILE))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	index, err := ParseIndex(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return index
+}
+
+func TestMoveToDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	archiveDir := filepath.Join(dir, "archive")
+
+	archive, err := Open(archiveDir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := archive.Add("Channel", episodeFiles(t, dir, "episode0.mp3")); err != nil {
+		t.Fatal(err)
+	}
+	// a second episode with the same name does not replace the first one
+	if err := os.Mkdir(filepath.Join(dir, "other"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	archived, err := archive.Add("Channel", episodeFiles(t, filepath.Join(dir, "other"), "episode0.mp3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := filepath.Join(archiveDir, "Channel", "episode0 (2).mp3")
+	if len(archived) != 1 || archived[0].Archive != expected {
+		t.Errorf("Wrong archive path: \n%q\n%v", expected, archived)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "episode0.mp3")); !os.IsNotExist(err) {
+		t.Errorf("The archived file was not removed: %v", err)
+	}
+
+	index := readIndex(t, archiveDir)
+	if len(index.Entries) != 2 || index.Entries[0].Archive != filepath.Join(archiveDir, "Channel", "episode0.mp3") || index.Entries[0].Archived == "" {
+		t.Errorf("Wrong index: %v", index.Entries)
+	}
+}
+
+// tarMembers returns the names of the members of tarball and checks that none is empty.
+func tarMembers(t *testing.T, tarball string) []string {
+	file, err := os.Open(tarball)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tarReader := tar.NewReader(gzipReader)
+
+	names := []string{}
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return names
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		data := &bytes.Buffer{}
+		if _, err := io.Copy(data, tarReader); err != nil {
+			t.Fatal(err)
+		}
+		if data.Len() == 0 {
+			t.Errorf("Member %q is empty", header.Name)
+		}
+		names = append(names, header.Name)
+	}
+}
+
+func TestAddToTarball(t *testing.T) {
+	dir, err := ioutil.TempDir("", "archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	archive, err := Open(dir, TAR_FORMAT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := archive.Add("Channel", episodeFiles(t, dir, "episode0.mp3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "other"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	entries := append(episodeFiles(t, dir, "episode1.mp3"), episodeFiles(t, filepath.Join(dir, "other"), "episode1.mp3")...)
+	second, err := archive.Add("Channel", entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(first) != 1 || first[0].Archive != archive.Destination("Channel", "") {
+		t.Errorf("Wrong first tarball: \n%q\n%v", archive.Destination("Channel", ""), first)
+	}
+	// a second run does not rewrite the tarball of the first one
+	if len(second) != 2 || second[0].Archive == first[0].Archive || second[1].Archive != second[0].Archive || second[1].Member != "episode1 (2).mp3" {
+		t.Errorf("Wrong second tarball: %v", second)
+	}
+
+	var tests = []struct {
+		tarball string
+		members []string
+	}{
+		{first[0].Archive, []string{"episode0.mp3"}},
+		{second[0].Archive, []string{"episode1.mp3", "episode1 (2).mp3"}},
+	}
+	for _, test := range tests {
+		if members := tarMembers(t, test.tarball); !reflect.DeepEqual(test.members, members) {
+			t.Errorf("Wrong members of %s: \n%q\n%q", test.tarball, test.members, members)
+		}
+	}
+
+	if index := readIndex(t, dir); len(index.Entries) != 3 {
+		t.Errorf("Wrong index: %v", index.Entries)
+	}
+}
+
+func TestOpenUnknownFormat(t *testing.T) {
+	if _, err := Open("archive", "zip"); err == nil {
+		t.Errorf("Expected an error for an unknown format")
+	}
+}
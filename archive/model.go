@@ -0,0 +1,45 @@
+package archive
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+)
+
+// Entry records an episode that has been archived.  Archive is the path of the archived
+// file or of the tarball that contains the episode as Member.
+type Entry struct {
+	XmlUrl   string `xml:"xmlUrl,attr"`
+	Guid     string `xml:"guid,attr"`
+	Title    string `xml:"title,attr,omitempty"`
+	PubDate  string `xml:"pubDate,attr,omitempty"`
+	Url      string `xml:"url,attr,omitempty"`
+	File     string `xml:"file,attr"`
+	Archive  string `xml:"archive,attr"`
+	Member   string `xml:"member,attr,omitempty"`
+	Archived string `xml:"archived,attr"`
+}
+
+// Index lists the episodes in an archive directory.
+type Index struct {
+	XMLName xml.Name `xml:"archive"`
+	Entries []Entry  `xml:"episode"`
+}
+
+func (index *Index) Write(writer io.Writer) (int, error) {
+	bytes, err := xml.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return -1, err
+	}
+
+	return writer.Write(bytes)
+}
+
+func (index Index) String() string {
+	var buffer = bytes.Buffer{}
+	if _, err := index.Write(&buffer); err != nil {
+		panic(err)
+	}
+
+	return buffer.String()
+}
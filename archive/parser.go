@@ -0,0 +1,16 @@
+package archive
+
+import (
+	"encoding/xml"
+	"io"
+)
+
+func ParseIndex(reader io.Reader) (*Index, error) {
+	decoder := xml.NewDecoder(reader)
+	var index Index
+	if err := decoder.Decode(&index); err != nil {
+		return nil, err
+	}
+
+	return &index, nil
+}
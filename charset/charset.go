@@ -0,0 +1,211 @@
+// Package charset converts XML documents in the character sets used by podcast feeds to
+// UTF-8, the only encoding encoding/xml supports without a CharsetReader.
+package charset
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"regexp"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+const UTF8 = "utf-8"
+
+var (
+	utf8Bom    = []byte{0xEF, 0xBB, 0xBF}
+	utf16LeBom = []byte{0xFF, 0xFE}
+	utf16BeBom = []byte{0xFE, 0xFF}
+
+	xmlDeclaration = regexp.MustCompile(`^\s*<\?xml[^>]*?\sencoding\s*=\s*["']([^"']*)["']`)
+)
+
+// windows1252 maps the bytes 0x80 to 0x9F of Windows-1252 to unicode, the other bytes are
+// the same as in ISO-8859-1.  Undefined bytes map to the C1 control of the same value.
+var windows1252 = [32]rune{
+	0x20AC, 0x0081, 0x201A, 0x0192, 0x201E, 0x2026, 0x2020, 0x2021,
+	0x02C6, 0x2030, 0x0160, 0x2039, 0x0152, 0x008D, 0x017D, 0x008F,
+	0x0090, 0x2018, 0x2019, 0x201C, 0x201D, 0x2022, 0x2013, 0x2014,
+	0x02DC, 0x2122, 0x0161, 0x203A, 0x0153, 0x009D, 0x017E, 0x0178,
+}
+
+// iso885915 are the bytes of ISO-8859-15 that differ from ISO-8859-1.
+var iso885915 = map[byte]rune{
+	0xA4: 0x20AC, 0xA6: 0x0160, 0xA8: 0x0161, 0xB4: 0x017D,
+	0xB8: 0x017E, 0xBC: 0x0152, 0xBD: 0x0153, 0xBE: 0x0178,
+}
+
+type decoder func(data []byte) ([]byte, error)
+
+func decodeWindows1252(data []byte) ([]byte, error) {
+	return decodeSingleByte(data, func(b byte) rune {
+		if b >= 0x80 && b <= 0x9F {
+			return windows1252[b-0x80]
+		}
+		return rune(b)
+	}), nil
+}
+
+func decodeIso885915(data []byte) ([]byte, error) {
+	return decodeSingleByte(data, func(b byte) rune {
+		if r, ok := iso885915[b]; ok {
+			return r
+		}
+		return rune(b)
+	}), nil
+}
+
+func decodeSingleByte(data []byte, toRune func(byte) rune) []byte {
+	decoded := make([]byte, 0, len(data)+len(data)/8)
+	for _, b := range data {
+		if b < utf8.RuneSelf {
+			decoded = append(decoded, b)
+			continue
+		}
+		decoded = append(decoded, string(toRune(b))...)
+	}
+	return decoded
+}
+
+func decodeUtf16(data []byte, bigEndian bool) ([]byte, error) {
+	if len(data)%2 != 0 {
+		return nil, fmt.Errorf("UTF-16 document has an odd number of bytes")
+	}
+
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		if bigEndian {
+			units[i] = uint16(data[2*i])<<8 | uint16(data[2*i+1])
+		} else {
+			units[i] = uint16(data[2*i+1])<<8 | uint16(data[2*i])
+		}
+	}
+	return []byte(string(utf16.Decode(units))), nil
+}
+
+// lookup returns the decoder of the charset label.  ISO-8859-1 and US-ASCII are decoded
+// as Windows-1252 like browsers do: feeds labeled ISO-8859-1 are often Windows-1252 and
+// the bytes where they differ are control characters in ISO-8859-1.
+func lookup(label string) (decoder, bool) {
+	switch strings.ToLower(strings.TrimSpace(label)) {
+	case "utf-8", "utf8":
+		return nil, true
+	case "iso-8859-1", "iso8859-1", "iso_8859-1", "latin1", "l1", "windows-1252", "cp1252", "x-cp1252", "us-ascii", "ascii":
+		return decodeWindows1252, true
+	case "iso-8859-15", "iso8859-15", "iso_8859-15", "latin9", "latin-9":
+		return decodeIso885915, true
+	case "utf-16le":
+		return func(data []byte) ([]byte, error) { return decodeUtf16(data, false) }, true
+	case "utf-16be", "utf-16":
+		// UTF-16 without a byte order mark is big endian
+		return func(data []byte) ([]byte, error) { return decodeUtf16(data, true) }, true
+	}
+	return nil, false
+}
+
+// sniffUtf16 detects UTF-16 without a byte order mark from the "<?" that starts the
+// document.
+func sniffUtf16(data []byte) (label string, ok bool) {
+	switch {
+	case bytes.HasPrefix(data, []byte{'<', 0, '?', 0}):
+		return "utf-16le", true
+	case bytes.HasPrefix(data, []byte{0, '<', 0, '?'}):
+		return "utf-16be", true
+	}
+	return "", false
+}
+
+// declaredEncoding returns the encoding of the XML declaration of data or "".
+func declaredEncoding(data []byte) string {
+	if match := xmlDeclaration.FindSubmatch(data); match != nil {
+		return string(match[1])
+	}
+	return ""
+}
+
+func contentTypeCharset(contentType string) string {
+	if contentType == "" {
+		return ""
+	}
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	return params["charset"]
+}
+
+// ToUtf8 converts an XML document to UTF-8.  The encoding is taken from the byte order
+// mark, the charset of the HTTP contentType and the encoding of the XML declaration, in
+// that order.  A UTF-8 charset of the Content-Type is ignored if the document is not valid
+// UTF-8, servers often send it for every file.  The encoding of the XML declaration of
+// the result is changed to UTF-8 so the result can be converted again.
+func ToUtf8(data []byte, contentType string) ([]byte, error) {
+	var label string
+	switch {
+	case bytes.HasPrefix(data, utf8Bom):
+		data, label = data[len(utf8Bom):], UTF8
+	case bytes.HasPrefix(data, utf16LeBom):
+		data, label = data[len(utf16LeBom):], "utf-16le"
+	case bytes.HasPrefix(data, utf16BeBom):
+		data, label = data[len(utf16BeBom):], "utf-16be"
+	default:
+		if sniffed, ok := sniffUtf16(data); ok {
+			label = sniffed
+		}
+	}
+
+	if label == "" {
+		label = contentTypeCharset(contentType)
+		if decode, ok := lookup(label); ok && decode == nil && !utf8.Valid(data) {
+			label = ""
+		}
+	}
+	if label == "" {
+		label = declaredEncoding(data)
+	}
+	if label == "" {
+		label = UTF8
+	}
+
+	decode, ok := lookup(label)
+	if !ok {
+		return nil, fmt.Errorf("Unsupported character set %q", label)
+	}
+	if decode != nil {
+		var err error
+		if data, err = decode(data); err != nil {
+			return nil, err
+		}
+	}
+
+	return declareUtf8(data), nil
+}
+
+// declareUtf8 replaces the encoding of the XML declaration of data with UTF-8.
+func declareUtf8(data []byte) []byte {
+	match := xmlDeclaration.FindSubmatchIndex(data)
+	if match == nil || strings.EqualFold(string(data[match[2]:match[3]]), UTF8) {
+		return data
+	}
+
+	converted := make([]byte, 0, len(data))
+	converted = append(converted, data[:match[2]]...)
+	converted = append(converted, "UTF-8"...)
+	return append(converted, data[match[3]:]...)
+}
+
+// NewReader returns a reader of the XML document of input converted to UTF-8, see ToUtf8.
+func NewReader(input io.Reader, contentType string) (io.Reader, error) {
+	data, err := ioutil.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+	if data, err = ToUtf8(data, contentType); err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(data), nil
+}
@@ -0,0 +1,84 @@
+package charset
+
+import (
+	"bytes"
+	"encoding/xml"
+	"testing"
+	"unicode/utf16"
+)
+
+func utf16Bytes(text string, bigEndian bool) []byte {
+	data := []byte{}
+	for _, unit := range utf16.Encode([]rune(text)) {
+		if bigEndian {
+			data = append(data, byte(unit>>8), byte(unit))
+		} else {
+			data = append(data, byte(unit), byte(unit>>8))
+		}
+	}
+	return data
+}
+
+func TestToUtf8(t *testing.T) {
+	const expected = "Café € “quoted”"
+
+	tests := []struct {
+		name        string
+		data        []byte
+		contentType string
+		expected    string
+	}{
+		{"utf-8", []byte(`<?xml version="1.0"?><title>` + expected + `</title>`), "", ""},
+		{"utf-8 bom", append([]byte{0xEF, 0xBB, 0xBF}, `<?xml version="1.0" encoding="ISO-8859-1"?><title>`+expected+`</title>`...), "", ""},
+		{"windows-1252", []byte("<?xml version=\"1.0\" encoding=\"windows-1252\"?><title>Caf\xe9 \x80 \x93quoted\x94</title>"), "", ""},
+		{"iso-8859-1 as windows-1252", []byte("<?xml version='1.0' encoding='ISO-8859-1'?><title>Caf\xe9 \x80 \x93quoted\x94</title>"), "", ""},
+		{"iso-8859-15", []byte("<?xml version=\"1.0\" encoding=\"iso-8859-15\"?><title>Caf\xe9 \xa4 \xbd</title>"), "", "Café € œ"},
+		{"utf-16le bom", append([]byte{0xFF, 0xFE}, utf16Bytes(`<?xml version="1.0" encoding="UTF-16"?><title>`+expected+`</title>`, false)...), "", ""},
+		{"utf-16be bom", append([]byte{0xFE, 0xFF}, utf16Bytes(`<?xml version="1.0" encoding="UTF-16"?><title>`+expected+`</title>`, true)...), "", ""},
+		{"utf-16le without bom", utf16Bytes(`<?xml version="1.0" encoding="UTF-16"?><title>`+expected+`</title>`, false), "", ""},
+		{"content type", []byte("<?xml version=\"1.0\"?><title>Caf\xe9 \x80 \x93quoted\x94</title>"), "application/rss+xml; charset=windows-1252", ""},
+		{"wrong utf-8 content type", []byte("<?xml version=\"1.0\" encoding=\"windows-1252\"?><title>Caf\xe9 \x80 \x93quoted\x94</title>"), "text/xml; charset=UTF-8", ""},
+	}
+
+	for _, test := range tests {
+		if test.expected == "" {
+			test.expected = expected
+		}
+
+		converted, err := ToUtf8(test.data, test.contentType)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+
+		var title string
+		if err := xml.NewDecoder(bytes.NewReader(converted)).Decode(&title); err != nil {
+			t.Errorf("%s: the converted document cannot be decoded: %v\n%q", test.name, err, converted)
+			continue
+		}
+		if title != test.expected {
+			t.Errorf("%s: \n%q\n%q", test.name, test.expected, title)
+		}
+	}
+}
+
+func TestToUtf8RejectsUnknownCharset(t *testing.T) {
+	if _, err := ToUtf8([]byte(`<?xml version="1.0" encoding="Shift_JIS"?><title/>`), ""); err == nil {
+		t.Errorf("Expected an error for an unsupported charset")
+	}
+}
+
+func TestToUtf8IsIdempotent(t *testing.T) {
+	data := []byte("<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?><title>Caf\xe9</title>")
+	once, err := ToUtf8(data, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	twice, err := ToUtf8(once, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(once, twice) {
+		t.Errorf("Converting twice changed the document: \n%q\n%q", once, twice)
+	}
+}
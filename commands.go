@@ -0,0 +1,520 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"gopod/config"
+	"gopod/opml"
+	"gopod/rss"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Exit codes returned by the gopod commands.  Scripts can rely on these values.
+const (
+	exitOK             = 0
+	exitFailure        = 1
+	exitUsage          = 2
+	exitPartialFailure = 3
+)
+
+type command struct {
+	name        string
+	args        string
+	description string
+	run         func(args []string) int
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{"sync", "", "Download new episodes of every subscription and prune old ones", syncCommand},
+		{"add", "<url>", "Subscribe to the podcast feed at <url>", addCommand},
+		{"remove", "<url|dir>", "Unsubscribe from a podcast by feed url or directory name", removeCommand},
+		{"list", "", "List the current subscriptions", listCommand},
+		{"prune", "", "Delete downloaded episodes that are no longer kept and report orphans", pruneCommand},
+		{"import", "<file>", "Add the subscriptions of an OPML file", importCommand},
+		{"export", "", "Write the subscriptions as OPML", exportCommand},
+		{"mark", "<file|guid>...", "Mark downloaded episodes as starred or played for the retention policies", markCommand},
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: gopod <command> [flags] [arguments]")
+	fmt.Fprintln(os.Stderr, "       gopod              same as 'gopod sync'")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", cmd.name, cmd.description)
+	}
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Run 'gopod <command> -h' for the flags of a command.")
+	fmt.Fprintf(os.Stderr, "Exit codes: %d success, %d failure, %d usage error, %d some feeds of a sync failed\n", exitOK, exitFailure, exitUsage, exitPartialFailure)
+}
+
+// run runs the command named by the first argument.  Without arguments gopod syncs, as it
+// did before it had commands, so existing cron jobs keep downloading.
+func run(args []string) int {
+	if len(args) == 0 {
+		args = []string{"sync"}
+	}
+
+	name := args[0]
+	if name == "-h" || name == "-help" || name == "--help" || name == "help" {
+		usage()
+		return exitOK
+	}
+
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return runCommand(cmd, args[1:])
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "gopod: unknown command %q\n", name)
+	usage()
+	return exitUsage
+}
+
+// runCommand runs cmd and turns the panics of the helpers that load and write the config
+// and the history into exitFailure.  An unrecovered panic would exit with the status of a
+// usage error.
+func runCommand(cmd command, args []string) (exitCode int) {
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Fprintf(os.Stderr, "gopod %s: %v\n", cmd.name, r)
+			exitCode = exitFailure
+		}
+	}()
+
+	return cmd.run(args)
+}
+
+func lookupCommand(name string) command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
+		}
+	}
+	panic("No command named: " + name)
+}
+
+// newFlagSet creates the flag set of a command.  Every command accepts -config to
+// choose the directory containing config.xml.
+func newFlagSet(name string) (flags *flag.FlagSet, configDir *string) {
+	cmd := lookupCommand(name)
+	flags = flag.NewFlagSet(name, flag.ContinueOnError)
+	configDir = flags.String("config", config.ConfigPathInUserHome(), "directory containing "+config.CONFIG_FILE)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: gopod %s [flags] %s\n\n%s\n\nFlags:\n", cmd.name, cmd.args, cmd.description)
+		flags.PrintDefaults()
+	}
+	return flags, configDir
+}
+
+// lockConfig prevents other gopod processes from modifying the config directory until
+// the returned unlock function is called.  ok is false if the lock could not be acquired.
+func lockConfig(configDir string) (unlock func(), ok bool) {
+	unlock, err := config.Lock(configDir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return nil, false
+	}
+	return unlock, true
+}
+
+// parseFlags parses the command line of a command and checks the number of positional
+// arguments.  ok is false if the command should exit with the returned exit code.
+func parseFlags(flags *flag.FlagSet, args []string, numArgs int) (exitCode int, ok bool) {
+	if err := flags.Parse(args); err == flag.ErrHelp {
+		return exitOK, false
+	} else if err != nil {
+		return exitUsage, false
+	}
+
+	if flags.NArg() != numArgs {
+		fmt.Fprintf(os.Stderr, "gopod %s: expected %d argument(s) but got %d\n", flags.Name(), numArgs, flags.NArg())
+		flags.Usage()
+		return exitUsage, false
+	}
+
+	return exitOK, true
+}
+
+func syncCommand(args []string) int {
+	flags, configDir := newFlagSet("sync")
+	noPrune := flags.Bool("no-prune", false, "do not delete episodes that are no longer kept")
+	dryRun := flags.Bool("dry-run", false, "fetch the feeds and report what would be downloaded, deleted and changed without writing anything")
+	reportFile := flags.String("report", "", "write a JSON report of the downloads and errors to `file`")
+	if code, ok := parseFlags(flags, args, 0); !ok {
+		return code
+	}
+	started := time.Now()
+
+	if *dryRun {
+		if !configExists(*configDir) {
+			return exitFailure
+		}
+	} else {
+		unlock, ok := lockConfig(*configDir)
+		if !ok {
+			return exitFailure
+		}
+		defer unlock()
+	}
+
+	configModel, configFile := loadConfig(*configDir)
+	onDisk := copyConfig(configModel)
+
+	if configModel.Head.DownloadDir == "" {
+		fmt.Fprintf(os.Stderr, "There is no DownloadDir element defined in head of %s\n", configFile)
+		return exitFailure
+	}
+
+	if configModel.Head.DefaultKeep == 0 {
+		configModel.Head.DefaultKeep = 1
+	}
+	client, err := rss.NewClient(configModel.Head)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid head of %s: %v\n", configFile, err)
+		return exitFailure
+	}
+	historyModel := loadHistory(*configDir)
+
+	results := downloadAll(configModel, historyModel, client, *dryRun)
+	report := newSyncReport(configModel, results, started, *dryRun)
+
+	if *dryRun {
+		reportDownloads(configModel, results)
+		reportConfigChanges(onDisk, configModel)
+	} else {
+		writeUpdatedConfig(configModel, configFile)
+	}
+
+	if !*noPrune {
+		if err := deleteOutOfDateFiles(configModel, historyModel, *dryRun, plannedFiles(results)); err != nil {
+			report.Errors = append(report.Errors, syncErrors(fmt.Errorf("Error occurred while deleting out of date files: %v", err), rss.DISK_ERROR)...)
+		}
+	}
+	if !*dryRun {
+		writeHistory(historyModel, *configDir)
+	}
+
+	if orphans, err := findOrphans(configModel, historyModel); err != nil {
+		report.Errors = append(report.Errors, syncErrors(err, rss.DISK_ERROR)...)
+	} else if len(orphans) > 0 {
+		log.Printf("%d files in %s are not tracked by gopod, run 'gopod prune' to list them\n", len(orphans), configModel.Head.DownloadDir)
+	}
+
+	return finishSync(report, *reportFile)
+}
+
+func addCommand(args []string) int {
+	flags, configDir := newFlagSet("add")
+	keep := flags.Int("keep", 0, "number of episodes to keep (0 uses DefaultKeep of the config)")
+	if code, ok := parseFlags(flags, args, 1); !ok {
+		return code
+	}
+
+	if *keep < 0 {
+		fmt.Fprintf(os.Stderr, "gopod add: -keep must not be negative: %d\n", *keep)
+		return exitUsage
+	}
+
+	unlock, ok := lockConfig(*configDir)
+	if !ok {
+		return exitFailure
+	}
+	defer unlock()
+
+	url := strings.TrimSpace(flags.Arg(0))
+	configModel, configFile := loadConfig(*configDir)
+
+	if configModel.Body.GetByXmlUrl(url) != nil {
+		fmt.Fprintf(os.Stderr, "Already subscribed to %s\n", url)
+		return exitFailure
+	}
+
+	client, err := rss.NewClient(configModel.Head)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid head of %s: %v\n", configFile, err)
+		return exitFailure
+	}
+
+	rssModel, err := rss.FetchRss(client, url)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s is not a valid podcast feed: %v\n", url, err)
+		return exitFailure
+	}
+
+	outline := opml.OpmlOutline{XmlUrl: url, Keep: *keep}
+	rss.UpdateOutline(configModel.Head, &outline, rssModel)
+
+	if outline.Title == "" {
+		fmt.Fprintf(os.Stderr, "%s is not a valid podcast feed: the channel has no title\n", url)
+		return exitFailure
+	}
+	if existing := configModel.Body.GetByDirName(outline.DirectoryName); existing != nil {
+		fmt.Fprintf(os.Stderr, "The podcast %q is already subscribed to from %s\n", outline.Title, existing.XmlUrl)
+		return exitFailure
+	}
+
+	configModel.Body.Outline = append(configModel.Body.Outline, outline)
+	writeUpdatedConfig(configModel, configFile)
+
+	fmt.Printf("Subscribed to %q (%d episodes)\n", outline.Title, len(rssModel.Channel.Items))
+	return exitOK
+}
+
+func removeCommand(args []string) int {
+	flags, configDir := newFlagSet("remove")
+	if code, ok := parseFlags(flags, args, 1); !ok {
+		return code
+	}
+
+	unlock, ok := lockConfig(*configDir)
+	if !ok {
+		return exitFailure
+	}
+	defer unlock()
+
+	key := flags.Arg(0)
+	configModel, configFile := loadConfig(*configDir)
+
+	url := key
+	if outline := configModel.Body.GetByDirName(key); outline != nil {
+		url = outline.XmlUrl
+	}
+
+	if !configModel.Body.Remove(url) {
+		fmt.Fprintf(os.Stderr, "No subscription found for %s\n", key)
+		return exitFailure
+	}
+	writeUpdatedConfig(configModel, configFile)
+
+	fmt.Printf("Unsubscribed from %s\n", url)
+	return exitOK
+}
+
+func listCommand(args []string) int {
+	flags, configDir := newFlagSet("list")
+	urlsOnly := flags.Bool("urls", false, "only print the feed urls")
+	if code, ok := parseFlags(flags, args, 0); !ok {
+		return code
+	}
+
+	configModel, _ := loadConfig(*configDir)
+
+	if *urlsOnly {
+		for _, outline := range configModel.Body.Outline {
+			fmt.Println(outline.XmlUrl)
+		}
+		return exitOK
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "TITLE\tKEEP\tLAST UPDATE\tURL")
+	for i := range configModel.Body.Outline {
+		outline := &configModel.Body.Outline[i]
+		fmt.Fprintf(writer, "%s\t%d\t%s\t%s\n", outline.Title, rss.KeepCount(configModel.Head, outline), outline.LastUpdate, outline.XmlUrl)
+	}
+	writer.Flush()
+
+	return exitOK
+}
+
+func pruneCommand(args []string) int {
+	flags, configDir := newFlagSet("prune")
+	dryRun := flags.Bool("dry-run", false, "report the files that would be deleted without deleting them")
+	orphans := flags.Bool("orphans", false, "archive the files in the download directory that gopod does not track to "+ORPHANS_DIR)
+	deleteOrphans := flags.Bool("delete", false, "delete the orphans instead of archiving them, requires -orphans")
+	if code, ok := parseFlags(flags, args, 0); !ok {
+		return code
+	}
+
+	if *deleteOrphans && !*orphans {
+		fmt.Fprintln(os.Stderr, "gopod prune: -delete requires -orphans")
+		return exitUsage
+	}
+
+	if *dryRun {
+		if !configExists(*configDir) {
+			return exitFailure
+		}
+	} else {
+		unlock, ok := lockConfig(*configDir)
+		if !ok {
+			return exitFailure
+		}
+		defer unlock()
+	}
+
+	configModel, configFile := loadConfig(*configDir)
+
+	if configModel.Head.DownloadDir == "" {
+		fmt.Fprintf(os.Stderr, "There is no DownloadDir element defined in head of %s\n", configFile)
+		return exitFailure
+	}
+
+	historyModel := loadHistory(*configDir)
+	err := deleteOutOfDateFiles(configModel, historyModel, *dryRun, nil)
+	if !*dryRun {
+		writeHistory(historyModel, *configDir)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error occurred while deleting out of date files: %v\n", err)
+		return exitFailure
+	}
+
+	orphanFiles, err := findOrphans(configModel, historyModel)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+
+	if !*orphans {
+		for _, orphan := range orphanFiles {
+			fmt.Printf("Orphan not tracked by gopod: %s\n", orphan)
+		}
+		if len(orphanFiles) > 0 {
+			fmt.Fprintf(os.Stderr, "Run 'gopod prune -orphans' to archive the %d orphans to %s or add -delete to delete them\n", len(orphanFiles), ORPHANS_DIR)
+		}
+		return exitOK
+	}
+
+	if err := removeOrphans(configModel.Head.DownloadDir, orphanFiles, *deleteOrphans, *dryRun); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+
+	return exitOK
+}
+
+func importCommand(args []string) int {
+	flags, configDir := newFlagSet("import")
+	if code, ok := parseFlags(flags, args, 1); !ok {
+		return code
+	}
+
+	unlock, ok := lockConfig(*configDir)
+	if !ok {
+		return exitFailure
+	}
+	defer unlock()
+
+	importFile, err := os.Open(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to open %s: %v\n", flags.Arg(0), err)
+		return exitFailure
+	}
+	defer importFile.Close()
+
+	imported, err := opml.ParseOpml(importFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to parse %s: %v\n", importFile.Name(), err)
+		return exitFailure
+	}
+
+	configModel, configFile := loadConfig(*configDir)
+
+	added := 0
+	for _, outline := range imported.Body.Outline {
+		if outline.XmlUrl == "" || configModel.Body.GetByXmlUrl(outline.XmlUrl) != nil {
+			continue
+		}
+		configModel.Body.Outline = append(configModel.Body.Outline, outline)
+		added++
+	}
+	writeUpdatedConfig(configModel, configFile)
+
+	fmt.Printf("Imported %d of %d subscriptions\n", added, len(imported.Body.Outline))
+	return exitOK
+}
+
+func exportCommand(args []string) int {
+	flags, configDir := newFlagSet("export")
+	output := flags.String("o", "", "file to write to instead of standard output")
+	if code, ok := parseFlags(flags, args, 0); !ok {
+		return code
+	}
+
+	configModel, _ := loadConfig(*configDir)
+
+	writer := os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to create %s: %v\n", *output, err)
+			return exitFailure
+		}
+		defer file.Close()
+		writer = file
+	}
+
+	if _, err := configModel.Write(writer); err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to export subscriptions: %v\n", err)
+		return exitFailure
+	}
+	fmt.Fprintln(writer)
+
+	return exitOK
+}
+
+func markCommand(args []string) int {
+	flags, configDir := newFlagSet("mark")
+	starred := flags.Bool("starred", false, "never delete the episodes")
+	unstarred := flags.Bool("unstarred", false, "remove the star of the episodes")
+	played := flags.Bool("played", false, "mark the episodes as played")
+	unplayed := flags.Bool("unplayed", false, "mark the episodes as not played")
+	if err := flags.Parse(args); err == flag.ErrHelp {
+		return exitOK
+	} else if err != nil {
+		return exitUsage
+	}
+
+	if flags.NArg() == 0 || (*starred && *unstarred) || (*played && *unplayed) || !(*starred || *unstarred || *played || *unplayed) {
+		fmt.Fprintln(os.Stderr, "gopod mark: expected at least one episode and one of -starred, -unstarred, -played or -unplayed")
+		flags.Usage()
+		return exitUsage
+	}
+
+	unlock, ok := lockConfig(*configDir)
+	if !ok {
+		return exitFailure
+	}
+	defer unlock()
+
+	historyModel := loadHistory(*configDir)
+
+	exitCode := exitOK
+	for _, key := range flags.Args() {
+		episode := historyModel.Find(key)
+		if episode == nil {
+			if absolute, err := filepath.Abs(key); err == nil {
+				episode = historyModel.Find(absolute)
+			}
+		}
+		if episode == nil {
+			fmt.Fprintf(os.Stderr, "No downloaded episode found for %s\n", key)
+			exitCode = exitFailure
+			continue
+		}
+
+		if *starred || *unstarred {
+			episode.Starred = *starred
+		}
+		if *played {
+			episode.Played = time.Now().Format(time.RFC3339)
+		} else if *unplayed {
+			episode.Played = ""
+		}
+	}
+	writeHistory(historyModel, *configDir)
+
+	return exitCode
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"gopod/config"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunExitCodes(t *testing.T) {
+	configDir, err := ioutil.TempDir("", "gopod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(configDir)
+
+	truncated := `<?xml version="1.0" encoding="UTF-8"?><opml version="2.0"><head><DownloadDir>/podcasts</Down`
+	if err := ioutil.WriteFile(filepath.Join(configDir, config.CONFIG_FILE), []byte(truncated), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		args     []string
+		expected int
+	}{
+		{[]string{"unknown"}, exitUsage},
+		{[]string{"list", "-unknown-flag"}, exitUsage},
+		{[]string{"list", "-config", configDir}, exitFailure},
+		{[]string{"prune", "-config", configDir}, exitFailure},
+	}
+
+	for _, test := range tests {
+		if actual := run(test.args); actual != test.expected {
+			t.Errorf("Wrong exit code of %q: \n%d\n%d", test.args, test.expected, actual)
+		}
+	}
+}
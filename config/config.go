@@ -2,15 +2,25 @@ package config
 
 import (
 	"gopod/opml"
+	"io"
+	"io/ioutil"
+	"log"
 	"os"
 	"os/user"
 	"path/filepath"
+	"sort"
+	"time"
 )
 
 const (
-	GO_POD_DIR         = ".gopod"
-	CONFIG_FILE        = "config.xml"
-	CONFIG_BACKUP_FILE = "config-backup.xml"
+	GO_POD_DIR   = ".gopod"
+	CONFIG_FILE  = "config.xml"
+	HISTORY_FILE = "history.xml"
+
+	CONFIG_BACKUP_PREFIX = "config-backup-"
+	CONFIG_BACKUP_EXT    = ".xml"
+	BACKUP_TIMESTAMP     = "2006-01-02T15-04-05.000"
+	MAX_BACKUPS          = 10
 )
 
 func ConfigPathInUserHome() string {
@@ -36,7 +46,7 @@ func openOrCreate(configDirName string, createFunc func(string) (*os.File, error
 
 func openConfigDir(configDirPath string) *os.File {
 	configDir := openOrCreate(configDirPath, func(path string) (*os.File, error) {
-		os.MkdirAll(path, os.ModeDir)
+		os.MkdirAll(path, 0755)
 		return os.Open(path)
 	})
 	return configDir
@@ -67,14 +77,63 @@ func ConfigFile(configDirPath string) *os.File {
 	return openOrCreate(filepath.Join(configDir.Name(), CONFIG_FILE), openOrCreateConfigFile)
 }
 
+func HistoryFilePath(configDirPath string) string {
+	configDir := openConfigDir(configDirPath)
+	defer configDir.Close()
+
+	return filepath.Join(configDirPath, HISTORY_FILE)
+}
+
+// BackupConfigFile creates a new timestamped backup file for config.xml and deletes the
+// oldest backups so that at most MAX_BACKUPS remain.
 func BackupConfigFile(configDirPath string) *os.File {
 	configDir := openConfigDir(configDirPath)
 	defer configDir.Close()
 
-	backupFile := filepath.Join(configDirPath, CONFIG_BACKUP_FILE)
+	timestamp := time.Now().Format(BACKUP_TIMESTAMP)
+	backupFile := filepath.Join(configDirPath, CONFIG_BACKUP_PREFIX+timestamp+CONFIG_BACKUP_EXT)
 	file, err := os.Create(backupFile)
 	if err != nil {
 		panic("Unable to create backup file: " + backupFile)
 	}
+
+	backups, err := filepath.Glob(filepath.Join(configDirPath, CONFIG_BACKUP_PREFIX+"*"+CONFIG_BACKUP_EXT))
+	if err == nil && len(backups) > MAX_BACKUPS {
+		// the timestamps sort chronologically
+		sort.Strings(backups)
+		for _, backup := range backups[:len(backups)-MAX_BACKUPS] {
+			if err := os.Remove(backup); err != nil {
+				log.Printf("Unable to delete old backup file %s: %v\n", backup, err)
+			}
+		}
+	}
+
 	return file
 }
+
+// WriteFileAtomically writes a file by calling write with a temporary file in the same
+// directory which replaces path once it has been completely written.
+func WriteFileAtomically(path string, write func(io.Writer) error) error {
+	file, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if err := write(file); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(file.Name(), 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), path)
+}
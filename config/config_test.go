@@ -0,0 +1,175 @@
+package config
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func tempConfigDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "gopod-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestLock(t *testing.T) {
+	dir := tempConfigDir(t)
+	defer os.RemoveAll(dir)
+
+	unlock, err := Lock(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Lock(dir); err == nil {
+		t.Fatal("A second lock should fail while the first is held")
+	}
+
+	unlock()
+	unlock, err = Lock(dir)
+	if err != nil {
+		t.Fatalf("Locking after unlock should succeed: %v", err)
+	}
+	unlock()
+}
+
+func TestLockAcquiresLeftoverLockFile(t *testing.T) {
+	dir := tempConfigDir(t)
+	defer os.RemoveAll(dir)
+
+	// the lock file of a process that exited, nothing holds the flock on it
+	lockPath := filepath.Join(dir, LOCK_FILE)
+	if err := ioutil.WriteFile(lockPath, []byte("12345\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	unlock, err := Lock(dir)
+	if err != nil {
+		t.Fatalf("A lock file without a holder should be acquired: %v", err)
+	}
+	pid := strconv.Itoa(os.Getpid())
+	if data, _ := ioutil.ReadFile(lockPath); strings.TrimSpace(string(data)) != pid {
+		t.Errorf("Wrong pid in the lock file: \n%q\n%q", pid, string(data))
+	}
+
+	_, err = Lock(dir)
+	if err == nil {
+		t.Fatal("A second lock should fail while the first is held")
+	}
+	if !strings.Contains(err.Error(), pid) {
+		t.Errorf("The error should name the pid holding the lock: %v", err)
+	}
+
+	unlock()
+	if _, err := os.Stat(lockPath); err != nil {
+		t.Errorf("The lock file should be kept after unlock: %v", err)
+	}
+	unlock, err = Lock(dir)
+	if err != nil {
+		t.Fatalf("Locking after unlock should succeed: %v", err)
+	}
+	unlock()
+}
+
+func TestLockIsExclusiveUnderContention(t *testing.T) {
+	dir := tempConfigDir(t)
+	defer os.RemoveAll(dir)
+
+	// a lock file of a process that exited without unlocking, every contender sees it
+	if err := ioutil.WriteFile(filepath.Join(dir, LOCK_FILE), []byte("999999999\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	const contenders = 20
+	start := make(chan bool)
+	unlocks := make(chan func(), contenders)
+	for i := 0; i < contenders; i++ {
+		go func() {
+			<-start
+			unlock, err := Lock(dir)
+			if err != nil {
+				unlock = nil
+			}
+			unlocks <- unlock
+		}()
+	}
+	close(start)
+
+	locked := 0
+	for i := 0; i < contenders; i++ {
+		if unlock := <-unlocks; unlock != nil {
+			locked++
+			defer unlock()
+		}
+	}
+	if locked != 1 {
+		t.Errorf("Exactly one contender should hold the lock: %d", locked)
+	}
+}
+
+func TestWriteFileAtomically(t *testing.T) {
+	dir := tempConfigDir(t)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, CONFIG_FILE)
+	if err := ioutil.WriteFile(path, []byte("original"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	err := WriteFileAtomically(path, func(writer io.Writer) error {
+		io.WriteString(writer, "partial")
+		return errors.New("write failed")
+	})
+	if err == nil {
+		t.Fatal("Expected the error of the write function")
+	}
+	if data, _ := ioutil.ReadFile(path); string(data) != "original" {
+		t.Errorf("A failed write must not change the file: %q", string(data))
+	}
+
+	err = WriteFileAtomically(path, func(writer io.Writer) error {
+		_, err := io.WriteString(writer, "updated")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadFile(path); string(data) != "updated" {
+		t.Errorf("File was not updated: %q", string(data))
+	}
+
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 1 {
+		t.Errorf("Temporary files were left behind: %v", files)
+	}
+}
+
+func TestBackupConfigFileRotates(t *testing.T) {
+	dir := tempConfigDir(t)
+	defer os.RemoveAll(dir)
+
+	for i := 0; i < MAX_BACKUPS+3; i++ {
+		// backups of an earlier run, they sort before the backup created now
+		oldName := filepath.Join(dir, CONFIG_BACKUP_PREFIX+"2014-08-11T21-20-"+string('a'+rune(i))+CONFIG_BACKUP_EXT)
+		if err := ioutil.WriteFile(oldName, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	BackupConfigFile(dir).Close()
+
+	backups, _ := filepath.Glob(filepath.Join(dir, CONFIG_BACKUP_PREFIX+"*"+CONFIG_BACKUP_EXT))
+	if len(backups) != MAX_BACKUPS {
+		t.Fatalf("Expected %d backups but got %d: %v", MAX_BACKUPS, len(backups), backups)
+	}
+	if _, err := os.Stat(filepath.Join(dir, CONFIG_BACKUP_PREFIX+"2014-08-11T21-20-a"+CONFIG_BACKUP_EXT)); !os.IsNotExist(err) {
+		t.Errorf("The oldest backup should have been deleted: %v", err)
+	}
+}
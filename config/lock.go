@@ -0,0 +1,53 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const LOCK_FILE = "gopod.lock"
+
+// Lock takes an advisory lock on a lock file in the config directory so that only one gopod
+// process modifies the configuration at a time.  The returned function releases the lock.
+// The lock is held with flock, the operating system releases it when the process exits so
+// a lock file left behind by a process that no longer runs does not need to be replaced.
+// The lock file records the pid of the process holding the lock for the error message.
+func Lock(configDirPath string) (unlock func(), err error) {
+	configDir := openConfigDir(configDirPath)
+	configDir.Close()
+
+	lockPath := filepath.Join(configDirPath, LOCK_FILE)
+	file, err := os.OpenFile(lockPath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to create lock file %s: %v", lockPath, err)
+	}
+
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		file.Close()
+		if err != syscall.EWOULDBLOCK {
+			return nil, fmt.Errorf("Unable to lock %s: %v", lockPath, err)
+		}
+
+		pidBytes, _ := ioutil.ReadFile(lockPath)
+		if pid, err := strconv.Atoi(strings.TrimSpace(string(pidBytes))); err == nil {
+			return nil, fmt.Errorf("Another gopod process (pid %d) is using %s", pid, configDirPath)
+		}
+		return nil, fmt.Errorf("Another gopod process is using %s", configDirPath)
+	}
+
+	// the file is not removed on unlock, a process waiting for it could lock the removed
+	// file while a third one creates and locks a new one
+	if err := file.Truncate(0); err == nil {
+		fmt.Fprintf(file, "%d\n", os.Getpid())
+	}
+
+	return func() {
+		syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+		file.Close()
+	}, nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"gopod/config"
+	"gopod/opml"
+	"os"
+	"path/filepath"
+	"reflect"
+)
+
+// configExists reports whether the config directory has a config file.  A dry run must not
+// create an empty config the way loadConfig does.
+func configExists(configDirPath string) bool {
+	configFilePath := filepath.Join(configDirPath, config.CONFIG_FILE)
+	if _, err := os.Stat(configFilePath); err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to read the subscriptions file %s: %v\n", configFilePath, err)
+		return false
+	}
+	return true
+}
+
+// copyConfig returns a copy of configModel whose outlines can be changed independently.
+func copyConfig(configModel *opml.Opml) *opml.Opml {
+	copied := *configModel
+	copied.Body.Outline = append([]opml.OpmlOutline(nil), configModel.Body.Outline...)
+	return &copied
+}
+
+// plannedFiles returns the files of the episodes the plans of the results download.
+func plannedFiles(results []feedResult) map[string]bool {
+	files := map[string]bool{}
+	for _, result := range results {
+		if result.plan == nil {
+			continue
+		}
+		for _, episode := range result.plan.Episodes {
+			files[episode.File] = true
+		}
+	}
+	return files
+}
+
+// reportDownloads prints the episodes the plans of the outlines download and the ones their
+// filters skip.
+func reportDownloads(configModel *opml.Opml, results []feedResult) {
+	for i, result := range results {
+		if result.plan == nil {
+			continue
+		}
+		for _, episode := range result.plan.Episodes {
+			fmt.Printf("Would download %q of %q from %s to %s\n", episode.Title, configModel.Body.Outline[i].Title, episode.Url, episode.File)
+		}
+		for _, episode := range result.plan.Skipped {
+			fmt.Printf("Would skip %q of %q, the %s\n", episode.Title, configModel.Body.Outline[i].Title, episode.Reason)
+		}
+	}
+}
+
+// reportConfigChanges prints the fields of the head and the outlines that differ between
+// the config on disk and the updated config.  The outlines are compared in order as a
+// sync neither adds nor removes outlines.
+func reportConfigChanges(onDisk, updated *opml.Opml) {
+	reportChangedFields("the head", reflect.ValueOf(onDisk.Head), reflect.ValueOf(updated.Head))
+	for i := range onDisk.Body.Outline {
+		reportChangedFields(onDisk.Body.Outline[i].XmlUrl, reflect.ValueOf(onDisk.Body.Outline[i]), reflect.ValueOf(updated.Body.Outline[i]))
+	}
+}
+
+func reportChangedFields(name string, before, after reflect.Value) {
+	for i := 0; i < before.NumField(); i++ {
+		oldValue, newValue := fmt.Sprint(before.Field(i).Interface()), fmt.Sprint(after.Field(i).Interface())
+		if oldValue != newValue {
+			fmt.Printf("Would change %s of %s from %q to %q\n", before.Type().Field(i).Name, name, oldValue, newValue)
+		}
+	}
+}
@@ -3,14 +3,13 @@ package main
 import (
 	"bufio"
 	"gopod/config"
+	"gopod/history"
 	"gopod/opml"
+	"gopod/rss"
 	"io"
 	"log"
 	"os"
-	"fmt"
-	"gopod/rss"
 	"path/filepath"
-	"sort"
 )
 
 func backupConfigFile(configDirPath string) {
@@ -28,139 +27,119 @@ func backupConfigFile(configDirPath string) {
 	log.Printf("Write %d bytes from original subscription file to backup file.\n", n)
 }
 
-func loadConfig() (configModel *opml.Opml, configFilePath string) {
-	configDirPath := config.ConfigPathInUserHome()
-
-	backupConfigFile(configDirPath)
-
+func loadConfig(configDirPath string) (configModel *opml.Opml, configFilePath string) {
 	configFile := config.ConfigFile(configDirPath)
 	defer configFile.Close()
 
 	opmlModel, err := opml.ParseOpml(configFile)
 	if err == io.EOF {
-		log.Fatal("Subscriptions file is not valid, file terminated unexpectedly.  Make sure that the file has a valid OPML format: " + configFile.Name())
+		panic("Subscriptions file is not valid, file terminated unexpectedly.  Make sure that the file has a valid OPML format: " + configFile.Name())
 	} else if err != nil {
 		panic("Unable to parse the subscriptions file: " + configFile.Name() + " due to " + err.Error())
 	}
 
 	return opmlModel, configFile.Name()
 }
-func download(index int, configModel *opml.Opml, doneChannel chan error) {
-	var err error
-	defer func() { doneChannel <- err }()
-
-	subscription := &configModel.Body.Outline[index]
-	_, err = rss.Download(configModel.Head, subscription);
-}
-func writeUpdatedConfig(configModel *opml.Opml, configFile string) {
-	file, err := os.Create(configFile)
-
-	if err != nil {
-		panic("Unable to create/truncate config file: " + err.Error())
-	}
-
-	if _, err = configModel.Write(file); err != nil {
-		panic("Unable to write updated config file: " + err.Error())
-	}
-}
-func list(filename string) ([]os.FileInfo, error) {
-	downloadDir, err := os.Open(filename)
-	if err != nil {
-		return nil, err
+func loadHistory(configDirPath string) *history.History {
+	historyFile, err := os.Open(config.HistoryFilePath(configDirPath))
+	if os.IsNotExist(err) {
+		return history.New()
+	} else if err != nil {
+		panic("Unable to open the history file: " + err.Error())
 	}
+	defer historyFile.Close()
 
-	dirs, err := downloadDir.Readdir(0)
+	historyModel, err := history.ParseHistory(historyFile)
 	if err != nil {
-		return nil, err
+		panic("Unable to parse the history file: " + historyFile.Name() + " due to " + err.Error())
 	}
 
-	return dirs, nil
-}
-type SortablePodcast []os.FileInfo
-func (s SortablePodcast) Len() int {
-	return len(s)
-}
-func (s SortablePodcast) Swap(i, j int) {
-	s[i], s[j] = s[j], s[i]
+	return historyModel
 }
-func (s SortablePodcast) Less(i, j int) bool {
-	return s[i].ModTime().After(s[j].ModTime())
-}
-func deleteOutOfDateFiles(configModel *opml.Opml) error {
-	typeNames, err := list(configModel.Head.DownloadDir)
+func writeHistory(historyModel *history.History, configDirPath string) {
+	err := config.WriteFileAtomically(config.HistoryFilePath(configDirPath), func(file io.Writer) error {
+		_, err := historyModel.Write(file)
+		return err
+	})
 	if err != nil {
-		return fmt.Errorf("deleteOutOfDateFile: Unable to list directories in downloadDir: %v", err)
+		panic("Unable to write history file: " + err.Error())
 	}
+}
 
-	for  _, dir := range typeNames {
-		dirName := filepath.Join(configModel.Head.DownloadDir, dir.Name())
-		channels, err := list (dirName)
-		if err != nil {
-			return fmt.Errorf("deleteOutOfDateFile: Unable to list channels in %v: %v", dirName, err)
-		}
-
-		for _, channel := range channels {
-			channelDir := filepath.Join(dirName, channel.Name())
-			title := filepath.Base(channel.Name())
-			outline := configModel.Body.GetByDirName(title)
-
-			if outline == nil {
-				panic("Unable to find podcast channel with title: " + title)
-			}
-
-			podcasts, err := list(channelDir)
+// feedResult is the outcome of downloading the new episodes of an outline.  plan is nil
+// if the feed could not be fetched.
+type feedResult struct {
+	plan       *rss.Plan
+	downloaded int
+	err        error
+}
 
-			if err != nil {
-				return fmt.Errorf("deleteOutOfDateFile: Unable to list podcasts in %v: %v", channelDir, err)
-			}
-			sort.Sort(SortablePodcast(podcasts))
-
-			for  i, podcast := range podcasts {
-				if i >= outline.Keep {
-					podcastFile := filepath.Join(channelDir, podcast.Name())
-					log.Printf("Deleting old podcast: %s\n", podcastFile)
-					err := os.Remove(podcastFile)
-					if err != nil {
-						log.Printf("Unable to delete expired podcast: %s", podcastFile)
-					}
-				}
+func download(indices <-chan int, configModel *opml.Opml, subscriptions []*history.Subscription, client *rss.Client, dryRun bool, results []feedResult, doneChannel chan bool) {
+	for index := range indices {
+		subscription := &configModel.Body.Outline[index]
+		result := &results[index]
+		result.plan, result.err = rss.PlanDownload(configModel.Head, subscription, subscriptions[index], client)
+		if result.err == nil {
+			if dryRun {
+				result.err = result.plan.Pretend()
+			} else {
+				result.downloaded, result.err = result.plan.Execute()
 			}
 		}
+		doneChannel <- true
 	}
-	return nil
 }
-func main() {
-	configModel, configFile := loadConfig()
 
-	if configModel.Head.DownloadDir == "" {
-		log.Fatalf("There is no DownloadDir element defined in head of %s", configFile)
+// downloadAll downloads the new episodes of every outline.  A dry run only fetches the feeds
+// and records the planned episodes in the history as if they were downloaded.  The results
+// are in the order of the outlines.
+func downloadAll(configModel *opml.Opml, historyModel *history.History, client *rss.Client, dryRun bool) []feedResult {
+	outlines := configModel.Body.Outline
+
+	subscriptions := make([]*history.Subscription, len(outlines))
+	for i, outline := range outlines {
+		subscriptions[i] = historyModel.Subscription(outline.XmlUrl)
 	}
 
-	if configModel.Head.DefaultKeep == 0 {
-		configModel.Head.DefaultKeep = 1
+	results := make([]feedResult, len(outlines))
+	indices := make(chan int)
+	done := make(chan bool)
+	for i := 0; i < client.MaxDownloads(); i++ {
+		go download(indices, configModel, subscriptions, client, dryRun, results, done)
 	}
-	done := make(chan error)
-	for i, _ := range configModel.Body.Outline {
-		go download(i, configModel, done)
+	go func() {
+		for i := range outlines {
+			indices <- i
+		}
+		close(indices)
+	}()
+
+	for range outlines {
+		<-done
 	}
 
-	errors := []error{}
-	for i := 0; i < len(configModel.Body.Outline); i++ {
-		if err := <-done; err != nil {
-			errors = append(errors, err)
+	// the feeds are moved once they have all been fetched so two feeds that move to the
+	// same url cannot both take it
+	for _, result := range results {
+		if result.plan != nil {
+			result.plan.Move(configModel, historyModel)
 		}
 	}
+	return results
+}
 
-	writeUpdatedConfig(configModel, configFile)
-
-	if err := deleteOutOfDateFiles(configModel); err != nil {
-		log.Fatalf("Error occurred while deleting out of date files: %v: ", err)
-	}
+// writeUpdatedConfig backs up the current config file and replaces it with configModel.
+func writeUpdatedConfig(configModel *opml.Opml, configFile string) {
+	backupConfigFile(filepath.Dir(configFile))
 
-	if len(errors) > 0 {
-		fmt.Printf("%d errors occurred during execution: \n", len(errors))
-		for _, err := range errors {
-			fmt.Printf("\t%v\n", err)
-		}
+	err := config.WriteFileAtomically(configFile, func(file io.Writer) error {
+		_, err := configModel.Write(file)
+		return err
+	})
+	if err != nil {
+		panic("Unable to write updated config file: " + err.Error())
 	}
 }
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
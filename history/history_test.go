@@ -0,0 +1,58 @@
+package history
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteParseHistory(t *testing.T) {
+	model := New()
+	subscription := model.Subscription("http://url0")
+	subscription.Add(Episode{Guid: "guid0", Title: "Episode 0", File: "/podcasts/episode0.mp3", Downloaded: "2014-08-11T21:20:36Z"})
+	subscription.Add(Episode{Guid: "http://url0/episode1.mp3", Downloaded: "2014-08-12T21:20:36Z"})
+	model.Subscription("http://url1").Add(Episode{Guid: "guid0"})
+
+	buffer := &bytes.Buffer{}
+	if _, err := model.Write(buffer); err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParseHistory(buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(parsed.Subscriptions) != 2 {
+		t.Fatalf("Wrong number of subscriptions: %d", len(parsed.Subscriptions))
+	}
+	parsedSubscription := parsed.Subscription("http://url0")
+	if len(parsedSubscription.Episodes) != 2 {
+		t.Fatalf("Wrong number of episodes: %v", parsedSubscription.Episodes)
+	}
+	for i, episode := range subscription.Episodes {
+		if parsedSubscription.Episodes[i] != episode {
+			t.Errorf("Episode %d does not match: \n%v\n%v", i, episode, parsedSubscription.Episodes[i])
+		}
+	}
+}
+
+func TestSubscriptionAdd(t *testing.T) {
+	model := New()
+	subscription := model.Subscription("http://url0")
+
+	if model.Subscription("http://url0") != subscription {
+		t.Fatal("Subscription should return the existing subscription")
+	}
+
+	subscription.Add(Episode{Guid: "guid0", Title: "First"})
+	subscription.Add(Episode{Guid: "guid0", Title: "Second"})
+
+	if len(subscription.Episodes) != 1 {
+		t.Fatalf("Adding an episode with the same guid should replace it: %v", subscription.Episodes)
+	}
+	if episode := subscription.Get("guid0"); episode == nil || episode.Title != "Second" {
+		t.Errorf("Wrong episode for guid0: %v", episode)
+	}
+	if subscription.Get("guid1") != nil {
+		t.Error("Expected no episode for guid1")
+	}
+}
@@ -0,0 +1,118 @@
+package history
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+)
+
+// Episode records an episode that has been downloaded.  Guid is the guid of the feed item
+// or the url of the enclosure if the item has no guid.
+type Episode struct {
+	Guid       string `xml:"guid,attr"`
+	Title      string `xml:"title,attr,omitempty"`
+	PubDate    string `xml:"pubDate,attr,omitempty"`
+	Url        string `xml:"url,attr,omitempty"`
+	File       string `xml:"file,attr,omitempty"`
+	Downloaded string `xml:"downloaded,attr"`
+	// Length is the size of the enclosure declared by the feed, 0 if it is unknown
+	Length int64 `xml:"length,attr,omitempty"`
+	// Deleted is set when File has been deleted
+	Deleted string `xml:"deleted,attr,omitempty"`
+	// Starred episodes are never deleted, Played is set when the episode has been listened to
+	Starred bool   `xml:"starred,attr,omitempty"`
+	Played  string `xml:"played,attr,omitempty"`
+}
+
+// Subscription contains the episodes downloaded from the feed at XmlUrl.
+type Subscription struct {
+	XmlUrl   string    `xml:"xmlUrl,attr"`
+	Episodes []Episode `xml:"episode"`
+}
+
+type History struct {
+	XMLName       xml.Name        `xml:"history"`
+	Subscriptions []*Subscription `xml:"subscription"`
+}
+
+func New() *History {
+	return &History{}
+}
+
+func (history *History) Write(writer io.Writer) (int, error) {
+	bytes, err := xml.MarshalIndent(history, "", "  ")
+	if err != nil {
+		return -1, err
+	}
+
+	return writer.Write(bytes)
+}
+
+func (history History) String() string {
+	var buffer = bytes.Buffer{}
+	if _, err := history.Write(&buffer); err != nil {
+		panic(err)
+	}
+
+	return buffer.String()
+}
+
+// Find returns the episode whose guid or file is key.
+func (history *History) Find(key string) *Episode {
+	for _, subscription := range history.Subscriptions {
+		if episode := subscription.Get(key); episode != nil {
+			return episode
+		}
+		if episode := subscription.GetByFile(key); episode != nil {
+			return episode
+		}
+	}
+
+	return nil
+}
+
+// Subscription returns the history of the feed at xmlUrl, creating it if it does not exist.
+// Subscription is not safe for concurrent use, the returned *Subscription can be used by
+// a different go routine than other subscriptions.
+func (history *History) Subscription(xmlUrl string) *Subscription {
+	for _, subscription := range history.Subscriptions {
+		if subscription.XmlUrl == xmlUrl {
+			return subscription
+		}
+	}
+
+	subscription := &Subscription{XmlUrl: xmlUrl}
+	history.Subscriptions = append(history.Subscriptions, subscription)
+	return subscription
+}
+
+func (subscription *Subscription) Get(guid string) *Episode {
+	for i := range subscription.Episodes {
+		if subscription.Episodes[i].Guid == guid {
+			return &subscription.Episodes[i]
+		}
+	}
+
+	return nil
+}
+
+// GetByFile returns the episode whose file is file and has not been deleted.
+func (subscription *Subscription) GetByFile(file string) *Episode {
+	for i := range subscription.Episodes {
+		if subscription.Episodes[i].File == file && subscription.Episodes[i].Deleted == "" {
+			return &subscription.Episodes[i]
+		}
+	}
+
+	return nil
+}
+
+// Add records episode, replacing an earlier record with the same Guid.
+func (subscription *Subscription) Add(episode Episode) {
+	if existing := subscription.Get(episode.Guid); existing != nil {
+		*existing = episode
+		return
+	}
+
+	subscription.Episodes = append(subscription.Episodes, episode)
+}
@@ -0,0 +1,16 @@
+package history
+
+import (
+	"encoding/xml"
+	"io"
+)
+
+func ParseHistory(reader io.Reader) (*History, error) {
+	decoder := xml.NewDecoder(reader)
+	var history History
+	if err := decoder.Decode(&history); err != nil {
+		return nil, err
+	}
+
+	return &history, nil
+}
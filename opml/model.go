@@ -11,14 +11,102 @@ type OpmlHead struct {
 	DateCreated string `xml:"dateCreated"`
 	DefaultKeep int
 	DownloadDir string
+	// MaxDownloads limits the number of feeds and episodes that are downloaded at the same
+	// time and MaxDownloadsPerHost the number of those that are from the same host.
+	MaxDownloads        int `xml:",omitempty"`
+	MaxDownloadsPerHost int `xml:",omitempty"`
+	// NamingTemplate is the path of downloaded episodes relative to DownloadDir, for
+	// example "{channel}/{pubdate:2006-01-02} - {title}.{ext}"
+	NamingTemplate string `xml:",omitempty"`
+	// FilenameMode is "posix" (the default) or "fat" to only create file names that are
+	// valid on FAT and exFAT file systems.
+	FilenameMode string `xml:",omitempty"`
+	// MaxTotalSize limits the size of all downloaded episodes, for example "20GB"
+	MaxTotalSize string `xml:",omitempty"`
+	// ArchiveDir is the directory expired episodes are moved to instead of being deleted,
+	// ArchiveFormat is "dir" (the default) or "tar.gz" for a new compressed tarball per
+	// channel and prune.
+	ArchiveDir    string `xml:",omitempty"`
+	ArchiveFormat string `xml:",omitempty"`
+	// ConnectTimeout and ReadTimeout limit the time to connect and the time a request may
+	// wait for data, for example "30s".  Failed requests are retried Retries times, -1
+	// disables retries, after RetryDelay which is doubled for every retry.  Proxy is the
+	// url of a proxy or "none" to ignore the proxy of the environment.
+	ConnectTimeout string `xml:",omitempty"`
+	ReadTimeout    string `xml:",omitempty"`
+	Retries        int    `xml:",omitempty"`
+	RetryDelay     string `xml:",omitempty"`
+	UserAgent      string `xml:",omitempty"`
+	Proxy          string `xml:",omitempty"`
 }
 
 type OpmlOutline struct {
-	XmlUrl        string `xml:"xmlUrl,attr"`
-	Keep          int
-	LastUpdate    string
-	Title         string     `xml:"title`
-	DirectoryName string `xml:"dir`
+	XmlUrl       string `xml:"xmlUrl,attr"`
+	Keep         int
+	LastUpdate   string
+	ETag         string `xml:",omitempty"`
+	LastModified string `xml:",omitempty"`
+	// NamingTemplate overrides the NamingTemplate of the head for this outline
+	NamingTemplate string `xml:",omitempty"`
+	// MaxAge deletes episodes older than the age, for example "30d".  MaxSize limits the
+	// size of the downloaded episodes, for example "2GB".  KeepUnplayed prevents deleting
+	// episodes that have not been marked as played.
+	MaxAge       string `xml:",omitempty"`
+	MaxSize      string `xml:",omitempty"`
+	KeepUnplayed bool   `xml:",omitempty"`
+	// Headers are sent with the requests for the feed and its episodes, for example the
+	// Authorization of a private feed
+	Headers []OpmlHeader `xml:"header,omitempty"`
+	// Filter limits the episodes that are downloaded, for example to skip trailers
+	Filter        *OpmlFilter `xml:"filter,omitempty"`
+	Title         string      `xml:"title,attr,omitempty"`
+	DirectoryName string      `xml:"dir,attr,omitempty"`
+}
+
+// UnmarshalXML also reads the Title and DirectoryName elements that configs written by
+// earlier versions contain instead of the title and dir attributes.
+func (outline *OpmlOutline) UnmarshalXML(decoder *xml.Decoder, start xml.StartElement) error {
+	type opmlOutline OpmlOutline
+	var legacy struct {
+		opmlOutline
+		LegacyTitle         string `xml:"Title"`
+		LegacyDirectoryName string `xml:"DirectoryName"`
+	}
+	if err := decoder.DecodeElement(&legacy, &start); err != nil {
+		return err
+	}
+
+	*outline = OpmlOutline(legacy.opmlOutline)
+	if outline.Title == "" {
+		outline.Title = legacy.LegacyTitle
+	}
+	if outline.DirectoryName == "" {
+		outline.DirectoryName = legacy.LegacyDirectoryName
+	}
+	return nil
+}
+
+type OpmlHeader struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+// OpmlFilter selects the episodes of an outline to download.  An episode is downloaded when
+// it matches every condition that is set.  The title and description conditions are regular
+// expressions, Category, ExcludeCategory and EpisodeType are comma separated lists that are
+// compared case insensitively, MinDuration and MaxDuration are durations such as "10m" and
+// Explicit is "yes" or "no".  Episodes whose duration is unknown pass the duration conditions.
+type OpmlFilter struct {
+	IncludeTitle       string `xml:"includeTitle,attr,omitempty"`
+	ExcludeTitle       string `xml:"excludeTitle,attr,omitempty"`
+	IncludeDescription string `xml:"includeDescription,attr,omitempty"`
+	ExcludeDescription string `xml:"excludeDescription,attr,omitempty"`
+	Category           string `xml:"category,attr,omitempty"`
+	ExcludeCategory    string `xml:"excludeCategory,attr,omitempty"`
+	EpisodeType        string `xml:"episodeType,attr,omitempty"`
+	MinDuration        string `xml:"minDuration,attr,omitempty"`
+	MaxDuration        string `xml:"maxDuration,attr,omitempty"`
+	Explicit           string `xml:"explicit,attr,omitempty"`
 }
 
 type OpmlBody struct {
@@ -55,6 +143,27 @@ func (opml Opml) String() string {
 	return buffer.String()
 }
 
+func (body *OpmlBody) GetByXmlUrl(url string) *OpmlOutline {
+	for i := range body.Outline {
+		if body.Outline[i].XmlUrl == url {
+			return &body.Outline[i]
+		}
+	}
+
+	return nil
+}
+
+func (body *OpmlBody) Remove(url string) bool {
+	for i := range body.Outline {
+		if body.Outline[i].XmlUrl == url {
+			body.Outline = append(body.Outline[:i], body.Outline[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
 func (body *OpmlBody) GetByDirName(name string) *OpmlOutline {
 	for _, outline := range body.Outline {
 		if outline.DirectoryName == name {
@@ -2,6 +2,7 @@ package opml
 
 import (
 	"bytes"
+	"reflect"
 	"testing"
 )
 
@@ -39,12 +40,56 @@ func TestParseOpml(t *testing.T) {
 	}
 }
 
+func TestParseLegacyOutline(t *testing.T) {
+	opmlData := `
+<opml version="2.0">
+  <head>
+    <dateCreated>Sun Aug 10 11:03:04 CEST 2014</dateCreated>
+    <DefaultKeep>3</DefaultKeep>
+    <DownloadDir>/podcasts</DownloadDir>
+  </head>
+  <body>
+    <outline xmlUrl="http://url0">
+      <Keep>2</Keep>
+      <LastUpdate>Sun, 10 Aug 2014 11:03:04 +0200</LastUpdate>
+      <Title>Global News</Title>
+      <DirectoryName>Global_News</DirectoryName>
+    </outline>
+  </body>
+</opml>`
+
+	model, err := ParseOpml(bytes.NewReader([]byte(opmlData)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := OpmlOutline{XmlUrl: "http://url0", Keep: 2, LastUpdate: "Sun, 10 Aug 2014 11:03:04 +0200",
+		Title: "Global News", DirectoryName: "Global_News"}
+	if len(model.Body.Outline) != 1 || !reflect.DeepEqual(expected, model.Body.Outline[0]) {
+		t.Fatalf("Wrong legacy outline: \n%v\n%v", expected, model.Body.Outline)
+	}
+
+	// the outline is written with attributes and read back unchanged
+	buffer := &bytes.Buffer{}
+	if _, err := model.Write(buffer); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(buffer.Bytes(), []byte(`title="Global News" dir="Global_News"`)) {
+		t.Errorf("Outline not written with attributes: \n%s", buffer.String())
+	}
+	if parsedModel, err := ParseOpml(buffer); err != nil {
+		t.Fatal(err)
+	} else {
+		equal(model, parsedModel, t)
+	}
+}
+
 func TestWriteOpml(t *testing.T) {
 	model := New()
 	model.Head.DateCreated = "Today"
 	model.Body.Outline = make([]OpmlOutline, 2)
-	model.Body.Outline[0] = OpmlOutline{"http://url0"}
-	model.Body.Outline[1] = OpmlOutline{"http://url1"}
+	model.Body.Outline[0] = OpmlOutline{XmlUrl: "http://url0"}
+	model.Body.Outline[1] = OpmlOutline{XmlUrl: "http://url1", Headers: []OpmlHeader{{Name: "Authorization", Value: "Bearer token"}},
+		Filter: &OpmlFilter{ExcludeTitle: "(?i)trailer", EpisodeType: "full", MinDuration: "10m"}}
 
 	buffer := &bytes.Buffer{}
 	if _, err := model.Write(buffer); err != nil {
@@ -53,7 +98,35 @@ func TestWriteOpml(t *testing.T) {
 	if parsedModel, err := ParseOpml(buffer); err != nil {
 		t.Fatal(err)
 	} else {
-		equal(&model, &parsedModel, t)
+		equal(&model, parsedModel, t)
+	}
+}
+
+func TestGetByXmlUrlAndRemove(t *testing.T) {
+	model := New()
+	model.Body.Outline = []OpmlOutline{{XmlUrl: "http://url0"}, {XmlUrl: "http://url1"}}
+
+	outline := model.Body.GetByXmlUrl("http://url1")
+	if outline == nil {
+		t.Fatal("Expected to find outline for http://url1")
+	}
+	outline.Keep = 3
+	if model.Body.Outline[1].Keep != 3 {
+		t.Error("GetByXmlUrl should return a pointer into the body")
+	}
+
+	if model.Body.GetByXmlUrl("http://missing") != nil {
+		t.Error("Expected no outline for http://missing")
+	}
+
+	if !model.Body.Remove("http://url0") {
+		t.Fatal("Expected http://url0 to be removed")
+	}
+	if len(model.Body.Outline) != 1 || model.Body.Outline[0].XmlUrl != "http://url1" {
+		t.Errorf("Wrong outlines after remove: %v", model.Body.Outline)
+	}
+	if model.Body.Remove("http://url0") {
+		t.Error("Removing a missing outline should return false")
 	}
 }
 
@@ -73,9 +146,25 @@ func equal(o1, o2 *Opml, t *testing.T) {
 	for i, bo1 := range o1.Body.Outline {
 		bo2 := o2.Body.Outline[i]
 
-		if bo1 != bo2 {
-			t.Errorf("Outline %d do not match: \n%v\n%v", bo1, bo2)
+		if !reflect.DeepEqual(bo1, bo2) {
+			t.Errorf("Outline %d do not match: \n%v\n%v", i, bo1, bo2)
 		}
 	}
 
 }
+
+func TestParseOpmlLatin1(t *testing.T) {
+	opmlData := "<?xml version='1.0' encoding='ISO-8859-1'?>\n<opml version=\"2.0\"><head><DownloadDir>/podcasts/Caf\xe9</DownloadDir></head>" +
+		"<body><outline xmlUrl=\"http://url0\" title=\"M\xfcnchen\"></outline></body></opml>"
+
+	model, err := ParseOpml(bytes.NewReader([]byte(opmlData)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if model.Head.DownloadDir != "/podcasts/Café" {
+		t.Errorf("Wrong DownloadDir: \n%q\n%q", "/podcasts/Café", model.Head.DownloadDir)
+	}
+	if len(model.Body.Outline) != 1 || model.Body.Outline[0].Title != "München" {
+		t.Errorf("Wrong outlines: %v", model.Body.Outline)
+	}
+}
@@ -2,10 +2,18 @@ package opml
 
 import (
 	"encoding/xml"
+	"gopod/charset"
 	"io"
 )
 
+// ParseOpml parses an OPML document.  Documents that are not UTF-8 are converted by
+// charset.NewReader.
 func ParseOpml(reader io.Reader) (*Opml, error) {
+	reader, err := charset.NewReader(reader, "")
+	if err != nil {
+		return nil, err
+	}
+
 	decoder := xml.NewDecoder(reader)
 	var opml Opml
 	if err := decoder.Decode(&opml); err != nil {
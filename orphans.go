@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"gopod/history"
+	"gopod/opml"
+	"gopod/rss"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// ORPHANS_DIR is the directory within DownloadDir that orphans are archived to.
+const ORPHANS_DIR = ".orphans"
+
+// trackedFiles returns the files that gopod downloaded for the current subscriptions and
+// has not deleted.
+func trackedFiles(configModel *opml.Opml, historyModel *history.History) map[string]bool {
+	tracked := map[string]bool{}
+	for _, outline := range configModel.Body.Outline {
+		for _, episode := range historyModel.Subscription(outline.XmlUrl).Episodes {
+			if episode.File != "" && episode.Deleted == "" {
+				tracked[filepath.Clean(episode.File)] = true
+			}
+		}
+	}
+	return tracked
+}
+
+// findOrphans returns the files in the download directory that are not tracked by the
+// history of a subscription, such as episodes of unsubscribed podcasts or files that were
+// added by hand.  Partial downloads, archived orphans and the ArchiveDir are not orphans.
+func findOrphans(configModel *opml.Opml, historyModel *history.History) ([]string, error) {
+	downloadDir := filepath.Clean(configModel.Head.DownloadDir)
+	archiveDir := filepath.Clean(configModel.Head.ArchiveDir)
+	tracked := trackedFiles(configModel, historyModel)
+	orphans := []string{}
+
+	err := filepath.Walk(downloadDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == downloadDir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if info.IsDir() {
+			if path == filepath.Join(downloadDir, ORPHANS_DIR) || (configModel.Head.ArchiveDir != "" && path == archiveDir) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !tracked[path] && !rss.IsPartialDownload(path) {
+			orphans = append(orphans, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to search %s for orphans: %v", downloadDir, err)
+	}
+
+	return orphans, nil
+}
+
+// removeOrphans moves the orphans to ORPHANS_DIR, keeping their path relative to the
+// download directory, or deletes them.  A dry run only prints what would be done.
+func removeOrphans(downloadDir string, orphans []string, deleteFiles, dryRun bool) error {
+	failed := 0
+	for _, orphan := range orphans {
+		if deleteFiles {
+			if dryRun {
+				fmt.Printf("Would delete orphan %s\n", orphan)
+				continue
+			}
+			log.Printf("Deleting orphan: %s\n", orphan)
+			if err := os.Remove(orphan); err != nil {
+				log.Printf("Unable to delete orphan: %v\n", err)
+				failed++
+			}
+			continue
+		}
+
+		relative, err := filepath.Rel(filepath.Clean(downloadDir), orphan)
+		if err != nil {
+			return err
+		}
+		archived := filepath.Join(downloadDir, ORPHANS_DIR, relative)
+		if dryRun {
+			fmt.Printf("Would archive orphan %s to %s\n", orphan, archived)
+			continue
+		}
+
+		if _, err := os.Stat(archived); err == nil {
+			log.Printf("Unable to archive orphan %s, %s already exists\n", orphan, archived)
+			failed++
+			continue
+		}
+		log.Printf("Archiving orphan %s to %s\n", orphan, archived)
+		if err := os.MkdirAll(filepath.Dir(archived), 0755); err != nil {
+			log.Printf("Unable to archive orphan: %v\n", err)
+			failed++
+			continue
+		}
+		if err := os.Rename(orphan, archived); err != nil {
+			log.Printf("Unable to archive orphan: %v\n", err)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d orphans could not be removed", failed, len(orphans))
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"gopod/config"
+	"gopod/history"
+	"gopod/opml"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+const testXmlUrl = "http://example.org/feed.xml"
+
+// testSetup creates a config directory whose config subscribes to testXmlUrl and a download
+// directory.  The returned function removes both.
+func testSetup(t *testing.T, head opml.OpmlHead, outline opml.OpmlOutline) (configDir, downloadDir string, cleanup func()) {
+	tempDir, err := ioutil.TempDir("", "gopod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	configDir = filepath.Join(tempDir, "config")
+	downloadDir = filepath.Join(tempDir, "downloads")
+	for _, dir := range []string{configDir, downloadDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	configModel := opml.New()
+	configModel.Head = head
+	configModel.Head.DownloadDir = downloadDir
+	outline.XmlUrl = testXmlUrl
+	configModel.Body.Outline = []opml.OpmlOutline{outline}
+	writeTestFile(t, filepath.Join(configDir, config.CONFIG_FILE), configModel.String())
+
+	return configDir, downloadDir, func() { os.RemoveAll(tempDir) }
+}
+
+func writeTestFile(t *testing.T, file, content string) {
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeTestHistory records the episodes as downloaded from testXmlUrl.
+func writeTestHistory(t *testing.T, configDir string, episodes ...history.Episode) {
+	historyModel := history.New()
+	subscription := historyModel.Subscription(testXmlUrl)
+	for _, episode := range episodes {
+		if episode.Downloaded == "" {
+			episode.Downloaded = time.Now().Format(time.RFC3339)
+		}
+		subscription.Add(episode)
+	}
+	writeHistory(historyModel, configDir)
+}
+
+func exists(file string) bool {
+	_, err := os.Stat(file)
+	return err == nil
+}
+
+func TestPruneOrphans(t *testing.T) {
+	configDir, downloadDir, cleanup := testSetup(t, opml.OpmlHead{}, opml.OpmlOutline{Keep: 5})
+	defer cleanup()
+
+	tracked := filepath.Join(downloadDir, "audio", "Show", "Episode 1.mp3")
+	unknown := filepath.Join(downloadDir, "Made By Hand", "notes.txt")
+	unsubscribed := filepath.Join(downloadDir, "audio", "Old Show", "Episode 9.mp3")
+	partial := filepath.Join(downloadDir, "audio", "Show", "Episode 2.mp3.part")
+	archived := filepath.Join(downloadDir, ORPHANS_DIR, "audio", "Older Show", "Episode 3.mp3")
+	for _, file := range []string{tracked, unknown, unsubscribed, partial, archived} {
+		writeTestFile(t, file, "podcast")
+	}
+	writeTestHistory(t, configDir, history.Episode{Guid: "episode-1", File: tracked})
+
+	configModel, _ := loadConfig(configDir)
+	orphans, err := findOrphans(configModel, loadHistory(configDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(orphans)
+	expected := []string{unknown, unsubscribed}
+	sort.Strings(expected)
+	if !reflect.DeepEqual(expected, orphans) {
+		t.Errorf("Wrong orphans: \n%q\n%q", expected, orphans)
+	}
+
+	if code := run([]string{"prune", "-config", configDir}); code != exitOK {
+		t.Fatalf("Prune with an unknown directory failed: %d", code)
+	}
+	for _, file := range []string{tracked, unknown, unsubscribed, partial, archived} {
+		if !exists(file) {
+			t.Errorf("Prune without -orphans removed %s", file)
+		}
+	}
+
+	if code := run([]string{"prune", "-config", configDir, "-orphans", "-dry-run"}); code != exitOK {
+		t.Fatalf("Prune -orphans -dry-run failed: %d", code)
+	}
+	if !exists(unknown) || !exists(unsubscribed) {
+		t.Error("A dry run moved the orphans")
+	}
+
+	if code := run([]string{"prune", "-config", configDir, "-orphans"}); code != exitOK {
+		t.Fatalf("Prune -orphans failed: %d", code)
+	}
+	for _, orphan := range []string{unknown, unsubscribed} {
+		relative, _ := filepath.Rel(downloadDir, orphan)
+		if exists(orphan) || !exists(filepath.Join(downloadDir, ORPHANS_DIR, relative)) {
+			t.Errorf("The orphan %s was not moved to %s", orphan, ORPHANS_DIR)
+		}
+	}
+	for _, file := range []string{tracked, partial, archived} {
+		if !exists(file) {
+			t.Errorf("Prune -orphans removed %s", file)
+		}
+	}
+
+	writeTestFile(t, unknown, "again")
+	if code := run([]string{"prune", "-config", configDir, "-orphans", "-delete"}); code != exitOK {
+		t.Fatalf("Prune -orphans -delete failed: %d", code)
+	}
+	if exists(unknown) {
+		t.Errorf("The orphan %s was not deleted", unknown)
+	}
+	for _, file := range []string{tracked, partial, archived} {
+		if !exists(file) {
+			t.Errorf("Prune -orphans -delete removed %s", file)
+		}
+	}
+
+	if code := run([]string{"prune", "-config", configDir, "-delete"}); code != exitUsage {
+		t.Errorf("-delete without -orphans should be a usage error: %d", code)
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"gopod/archive"
+	"gopod/history"
+	"gopod/opml"
+	"gopod/retention"
+	"gopod/rss"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// retentionPolicies returns the policies configured for the outline.
+func retentionPolicies(head opml.OpmlHead, outline *opml.OpmlOutline) ([]retention.Policy, error) {
+	policies := []retention.Policy{retention.KeepNewest(rss.KeepCount(head, outline))}
+
+	if outline.MaxAge != "" {
+		age, err := retention.ParseAge(outline.MaxAge)
+		if err != nil {
+			return nil, fmt.Errorf("MaxAge of %s: %v", outline.XmlUrl, err)
+		}
+		policies = append(policies, retention.MaxAge(age))
+	}
+
+	if outline.MaxSize != "" {
+		size, err := retention.ParseSize(outline.MaxSize)
+		if err != nil {
+			return nil, fmt.Errorf("MaxSize of %s: %v", outline.XmlUrl, err)
+		}
+		policies = append(policies, retention.MaxSize(size))
+	}
+
+	return policies, nil
+}
+
+// publishedTime is the publish date of the episode or the time it was downloaded if the
+// feed's date cannot be parsed.
+func publishedTime(episode *history.Episode) time.Time {
+	if published, err := rss.ParsePubDate(episode.PubDate); err == nil {
+		return published
+	}
+	downloaded, _ := time.Parse(time.RFC3339, episode.Downloaded)
+	return downloaded
+}
+
+// deleteOutOfDateFiles deletes the files downloaded by gopod that the retention policies
+// of their outline or the MaxTotalSize of the head no longer keep.  Only files recorded in
+// the history are considered, deleted files stay in the history so they are not
+// downloaded again.
+//
+// A dry run only prints the files that would be deleted.  The planned files of a dry sync
+// do not exist yet, their size is the length of their enclosure.
+func deleteOutOfDateFiles(configModel *opml.Opml, historyModel *history.History, dryRun bool, planned map[string]bool) error {
+	now := time.Now()
+	deletedAt := now.Format(time.RFC3339)
+
+	historyEpisodes := map[*retention.Episode]*history.Episode{}
+	outlines := map[*retention.Episode]*opml.OpmlOutline{}
+	expired := []*retention.Episode{}
+	kept := []*retention.Episode{}
+
+	for i := range configModel.Body.Outline {
+		outline := &configModel.Body.Outline[i]
+		policies, err := retentionPolicies(configModel.Head, outline)
+		if err != nil {
+			return err
+		}
+
+		episodes := historyModel.Subscription(outline.XmlUrl)
+		candidates := []*retention.Episode{}
+		for j := range episodes.Episodes {
+			episode := &episodes.Episodes[j]
+			if episode.File == "" || episode.Deleted != "" {
+				continue
+			}
+
+			var size int64
+			info, err := os.Stat(episode.File)
+			switch {
+			case err == nil:
+				size = info.Size()
+			case planned[episode.File]:
+				size = episode.Length
+			case os.IsNotExist(err):
+				log.Printf("Podcast was deleted outside of gopod: %s\n", episode.File)
+				episode.Deleted = deletedAt
+				continue
+			default:
+				return fmt.Errorf("deleteOutOfDateFile: Unable to access podcast %v: %v", episode.File, err)
+			}
+
+			candidate := &retention.Episode{
+				File:      episode.File,
+				Published: publishedTime(episode),
+				Size:      size,
+				Protected: episode.Starred || (outline.KeepUnplayed && episode.Played == "")}
+			historyEpisodes[candidate] = episode
+			outlines[candidate] = outline
+			candidates = append(candidates, candidate)
+		}
+
+		outlineExpired := retention.Apply(candidates, now, policies...)
+		expired = append(expired, outlineExpired...)
+		kept = append(kept, without(candidates, outlineExpired)...)
+	}
+
+	if configModel.Head.MaxTotalSize != "" {
+		size, err := retention.ParseSize(configModel.Head.MaxTotalSize)
+		if err != nil {
+			return fmt.Errorf("MaxTotalSize: %v", err)
+		}
+		expired = append(expired, retention.Apply(kept, now, retention.MaxSize(size))...)
+	}
+
+	if configModel.Head.ArchiveDir != "" {
+		return archiveExpired(configModel.Head, expired, historyEpisodes, outlines, dryRun, deletedAt)
+	}
+
+	for _, candidate := range expired {
+		if dryRun {
+			fmt.Printf("Would delete %s\n", candidate.File)
+			continue
+		}
+		log.Printf("Deleting old podcast: %s\n", candidate.File)
+		if err := os.Remove(candidate.File); err != nil {
+			log.Printf("Unable to delete expired podcast: %s", candidate.File)
+			continue
+		}
+		historyEpisodes[candidate].Deleted = deletedAt
+	}
+	return nil
+}
+
+// archiveExpired moves the expired episodes to the ArchiveDir of the head instead of
+// deleting them.  Archived episodes are marked as deleted in the history like deleted ones.
+func archiveExpired(head opml.OpmlHead, expired []*retention.Episode, historyEpisodes map[*retention.Episode]*history.Episode, outlines map[*retention.Episode]*opml.OpmlOutline, dryRun bool, deletedAt string) error {
+	archiver, err := archive.Open(head.ArchiveDir, head.ArchiveFormat)
+	if err != nil {
+		return err
+	}
+
+	channels := []string{}
+	entries := map[string][]archive.Entry{}
+	for _, candidate := range expired {
+		outline, episode := outlines[candidate], historyEpisodes[candidate]
+		channel := outline.DirectoryName
+		if channel == "" {
+			channel = filepath.Base(filepath.Dir(episode.File))
+		}
+
+		if dryRun {
+			fmt.Printf("Would archive %s to %s\n", episode.File, archiver.Destination(channel, episode.File))
+			continue
+		}
+
+		if _, ok := entries[channel]; !ok {
+			channels = append(channels, channel)
+		}
+		entries[channel] = append(entries[channel], archive.Entry{
+			XmlUrl:  outline.XmlUrl,
+			Guid:    episode.Guid,
+			Title:   episode.Title,
+			PubDate: episode.PubDate,
+			Url:     episode.Url,
+			File:    episode.File})
+	}
+
+	archivedFiles := map[string]bool{}
+	for _, channel := range channels {
+		log.Printf("Archiving %d old podcasts of %s to %s\n", len(entries[channel]), channel, archiver.Destination(channel, ""))
+		archived, err := archiver.Add(channel, entries[channel])
+		if err != nil {
+			log.Printf("Unable to archive expired podcasts: %v\n", err)
+		}
+		for _, entry := range archived {
+			archivedFiles[entry.File] = true
+		}
+	}
+
+	for _, candidate := range expired {
+		if archivedFiles[candidate.File] {
+			historyEpisodes[candidate].Deleted = deletedAt
+		}
+	}
+
+	return archiver.Close()
+}
+
+func without(episodes, excluded []*retention.Episode) []*retention.Episode {
+	excludedSet := map[*retention.Episode]bool{}
+	for _, episode := range excluded {
+		excludedSet[episode] = true
+	}
+
+	remaining := []*retention.Episode{}
+	for _, episode := range episodes {
+		if !excludedSet[episode] {
+			remaining = append(remaining, episode)
+		}
+	}
+	return remaining
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"gopod/history"
+	"gopod/opml"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// pruneEpisode is an episode of a test feed, published the given number of days ago.
+type pruneEpisode struct {
+	name    string
+	age     int
+	starred bool
+	played  bool
+	missing bool
+}
+
+// pruneSetup writes the episodes of every feed to a temporary download directory, with a
+// modification time opposite to their publish date, and records them in the history.
+func pruneSetup(t *testing.T, outlines []opml.OpmlOutline, feeds [][]pruneEpisode) (downloadDir string, historyModel *history.History, cleanup func()) {
+	downloadDir, err := ioutil.TempDir("", "gopod")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	historyModel = history.New()
+	for i, episodes := range feeds {
+		subscription := historyModel.Subscription(outlines[i].XmlUrl)
+		for _, episode := range episodes {
+			file := filepath.Join(downloadDir, outlines[i].Title, episode.name+".mp3")
+			published := now.AddDate(0, 0, -episode.age)
+			if !episode.missing {
+				writeTestFile(t, file, "podcast")
+				modified := now.AddDate(0, 0, episode.age-100)
+				if err := os.Chtimes(file, modified, modified); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			historyEpisode := history.Episode{
+				Guid:       episode.name,
+				PubDate:    published.Format(time.RFC1123Z),
+				File:       file,
+				Downloaded: now.Format(time.RFC3339),
+				Starred:    episode.starred}
+			if episode.played {
+				historyEpisode.Played = now.Format(time.RFC3339)
+			}
+			subscription.Add(historyEpisode)
+		}
+	}
+	return downloadDir, historyModel, func() { os.RemoveAll(downloadDir) }
+}
+
+// deletedEpisodes returns the sorted guids of the episodes marked as deleted.
+func deletedEpisodes(historyModel *history.History) []string {
+	deleted := []string{}
+	for _, subscription := range historyModel.Subscriptions {
+		for _, episode := range subscription.Episodes {
+			if episode.Deleted != "" {
+				deleted = append(deleted, episode.Guid)
+			}
+		}
+	}
+	sort.Strings(deleted)
+	return deleted
+}
+
+func contains(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
+
+func TestDeleteOutOfDateFiles(t *testing.T) {
+	var tests = []struct {
+		name     string
+		head     opml.OpmlHead
+		outlines []opml.OpmlOutline
+		feeds    [][]pruneEpisode
+		deleted  []string
+	}{
+		{"newest by publish date",
+			opml.OpmlHead{},
+			[]opml.OpmlOutline{{Title: "Show", XmlUrl: "http://example.org/show.xml", Keep: 1}},
+			[][]pruneEpisode{{{name: "new", age: 1}, {name: "old", age: 2}}},
+			[]string{"old"}},
+		{"keep unplayed and starred",
+			opml.OpmlHead{},
+			[]opml.OpmlOutline{{Title: "Show", XmlUrl: "http://example.org/show.xml", Keep: 1, KeepUnplayed: true}},
+			[][]pruneEpisode{{
+				{name: "newest", age: 1, played: true},
+				{name: "unplayed", age: 2},
+				{name: "starred", age: 3, played: true, starred: true},
+				{name: "played", age: 4, played: true}}},
+			[]string{"played"}},
+		{"deleted outside of gopod",
+			opml.OpmlHead{},
+			[]opml.OpmlOutline{{Title: "Show", XmlUrl: "http://example.org/show.xml", Keep: 5}},
+			[][]pruneEpisode{{{name: "kept", age: 1}, {name: "missing", age: 2, missing: true}}},
+			[]string{"missing"}},
+		{"max total size across outlines",
+			opml.OpmlHead{MaxTotalSize: "15B"},
+			[]opml.OpmlOutline{
+				{Title: "Show", XmlUrl: "http://example.org/show.xml", Keep: 5},
+				{Title: "Other Show", XmlUrl: "http://example.org/other.xml", Keep: 5}},
+			[][]pruneEpisode{
+				{{name: "show-1", age: 1}, {name: "show-3", age: 3}},
+				{{name: "other-2", age: 2}, {name: "other-4", age: 4}}},
+			[]string{"other-4", "show-3"}},
+	}
+
+	for _, test := range tests {
+		downloadDir, historyModel, cleanup := pruneSetup(t, test.outlines, test.feeds)
+
+		configModel := opml.New()
+		configModel.Head = test.head
+		configModel.Head.DownloadDir = downloadDir
+		configModel.Body.Outline = test.outlines
+
+		if err := deleteOutOfDateFiles(&configModel, historyModel, true, nil); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		for i, episodes := range test.feeds {
+			for _, episode := range episodes {
+				file := filepath.Join(downloadDir, test.outlines[i].Title, episode.name+".mp3")
+				if !episode.missing && !exists(file) {
+					t.Errorf("%s: a dry run deleted %s", test.name, file)
+				}
+			}
+		}
+
+		if err := deleteOutOfDateFiles(&configModel, historyModel, false, nil); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		deleted := deletedEpisodes(historyModel)
+		if !reflect.DeepEqual(test.deleted, deleted) {
+			t.Errorf("%s: wrong deleted episodes: \n%q\n%q", test.name, test.deleted, deleted)
+		}
+		for i, episodes := range test.feeds {
+			for _, episode := range episodes {
+				file := filepath.Join(downloadDir, test.outlines[i].Title, episode.name+".mp3")
+				expected := !episode.missing && !contains(test.deleted, episode.name)
+				if exists(file) != expected {
+					t.Errorf("%s: %s should exist: %v", test.name, file, expected)
+				}
+			}
+		}
+		cleanup()
+	}
+}
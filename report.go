@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gopod/config"
+	"gopod/opml"
+	"gopod/rss"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// syncError is an error of a sync as it is shown in the summary and the report.
+type syncError struct {
+	Kind    string `json:"kind"`
+	Feed    string `json:"feed,omitempty"`
+	Episode string `json:"episode,omitempty"`
+	Url     string `json:"url,omitempty"`
+	Message string `json:"error"`
+}
+
+type feedReport struct {
+	Feed       string   `json:"feed"`
+	Title      string   `json:"title"`
+	Planned    int      `json:"planned"`
+	Downloaded int      `json:"downloaded"`
+	Errors     int      `json:"errors"`
+	Warnings   []string `json:"warnings,omitempty"`
+	Skipped    []string `json:"skipped,omitempty"`
+}
+
+// syncReport is written as JSON to the file given by sync -report.
+type syncReport struct {
+	Started  string       `json:"started"`
+	Finished string       `json:"finished"`
+	DryRun   bool         `json:"dryRun,omitempty"`
+	ExitCode int          `json:"exitCode"`
+	Feeds    []feedReport `json:"feeds"`
+	Errors   []syncError  `json:"errors"`
+}
+
+// syncErrors converts err into the errors of the summary.  The errors of rss.Download
+// carry their kind and feed, other errors are of kind defaultKind.
+func syncErrors(err error, defaultKind rss.ErrorKind) []syncError {
+	var downloadErrors rss.Errors
+	if errors.As(err, &downloadErrors) {
+		converted := []syncError{}
+		for _, downloadError := range downloadErrors {
+			converted = append(converted, syncErrors(downloadError, defaultKind)...)
+		}
+		return converted
+	}
+
+	var downloadError *rss.Error
+	if errors.As(err, &downloadError) {
+		return []syncError{{
+			Kind:    string(downloadError.Kind),
+			Feed:    downloadError.XmlUrl,
+			Episode: downloadError.Episode,
+			Url:     downloadError.Url,
+			Message: downloadError.Err.Error()}}
+	}
+
+	return []syncError{{Kind: string(defaultKind), Message: err.Error()}}
+}
+
+// newSyncReport summarizes the results of downloading the outlines of configModel.
+func newSyncReport(configModel *opml.Opml, results []feedResult, started time.Time, dryRun bool) *syncReport {
+	report := &syncReport{
+		Started: started.Format(time.RFC3339),
+		DryRun:  dryRun,
+		Feeds:   []feedReport{},
+		Errors:  []syncError{}}
+
+	for i, result := range results {
+		outline := configModel.Body.Outline[i]
+		feed := feedReport{Feed: outline.XmlUrl, Title: outline.Title, Downloaded: result.downloaded}
+		if result.plan != nil {
+			feed.Planned = len(result.plan.Episodes)
+			feed.Warnings = result.plan.Warnings
+			for _, episode := range result.plan.Skipped {
+				feed.Skipped = append(feed.Skipped, fmt.Sprintf("%s: the %s", episode.Title, episode.Reason))
+			}
+		}
+		if result.err != nil {
+			errs := syncErrors(result.err, rss.FETCH_ERROR)
+			feed.Errors = len(errs)
+			report.Errors = append(report.Errors, errs...)
+		}
+		report.Feeds = append(report.Feeds, feed)
+	}
+
+	return report
+}
+
+// exitCode is exitOK without errors, exitPartialFailure if some feeds were synced or some
+// episodes were downloaded despite the errors and exitFailure if nothing was.  A dry run
+// counts the planned episodes as downloaded.
+func (report *syncReport) exitCode() int {
+	if len(report.Errors) == 0 {
+		return exitOK
+	}
+	for _, feed := range report.Feeds {
+		if feed.Errors == 0 || feed.Downloaded > 0 || (report.DryRun && feed.Planned > 0) {
+			return exitPartialFailure
+		}
+	}
+	return exitFailure
+}
+
+// printSummary prints a table of the errors of the sync.
+func (report *syncReport) printSummary(writer io.Writer) {
+	if len(report.Errors) == 0 {
+		return
+	}
+
+	fmt.Fprintf(writer, "%d errors occurred during execution:\n", len(report.Errors))
+	table := tabwriter.NewWriter(writer, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "KIND\tFEED\tEPISODE\tERROR")
+	for _, err := range report.Errors {
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\n", err.Kind, err.Feed, err.Episode, err.Message)
+	}
+	table.Flush()
+}
+
+// write writes the report as JSON to path.
+func (report *syncReport) write(path string) error {
+	return config.WriteFileAtomically(path, func(file io.Writer) error {
+		encoder := json.NewEncoder(file)
+		encoder.SetIndent("", "  ")
+		encoder.SetEscapeHTML(false)
+		return encoder.Encode(report)
+	})
+}
+
+// finishSync completes the report, prints the summary and writes the report file if
+// reportFile is not empty.  It returns the exit code of the sync.
+func finishSync(report *syncReport, reportFile string) int {
+	report.Finished = time.Now().Format(time.RFC3339)
+	report.ExitCode = report.exitCode()
+	report.printSummary(os.Stdout)
+
+	if reportFile != "" {
+		if err := report.write(reportFile); err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to write the report %s: %v\n", reportFile, err)
+			return exitFailure
+		}
+	}
+
+	return report.ExitCode
+}
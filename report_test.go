@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"gopod/rss"
+	"reflect"
+	"testing"
+)
+
+func TestExitCode(t *testing.T) {
+	fetchError := []syncError{{Kind: "fetch", Feed: "http://feed1", Message: "connection refused"}}
+
+	tests := []struct {
+		name     string
+		report   syncReport
+		expected int
+	}{
+		{"no feeds", syncReport{}, exitOK},
+		{"no errors", syncReport{Feeds: []feedReport{{Downloaded: 2}, {}}}, exitOK},
+		{"one feed failed", syncReport{Feeds: []feedReport{{Errors: 1}, {Downloaded: 1}}, Errors: fetchError}, exitPartialFailure},
+		{"some episodes failed", syncReport{Feeds: []feedReport{{Planned: 4, Downloaded: 3, Errors: 1}}, Errors: fetchError}, exitPartialFailure},
+		{"every episode failed", syncReport{Feeds: []feedReport{{Planned: 4, Errors: 4}}, Errors: fetchError}, exitFailure},
+		{"every feed failed", syncReport{Feeds: []feedReport{{Errors: 1}, {Errors: 1}}, Errors: fetchError}, exitFailure},
+		{"dry run", syncReport{DryRun: true, Feeds: []feedReport{{Planned: 2, Errors: 1}}, Errors: fetchError}, exitPartialFailure},
+		{"prune failed", syncReport{Feeds: []feedReport{{Downloaded: 1}}, Errors: []syncError{{Kind: "disk"}}}, exitPartialFailure},
+	}
+
+	for _, test := range tests {
+		if actual := test.report.exitCode(); actual != test.expected {
+			t.Errorf("Wrong exit code for %s: \n%d\n%d", test.name, test.expected, actual)
+		}
+	}
+}
+
+func TestSyncErrors(t *testing.T) {
+	mediaError := &rss.Error{Kind: rss.MEDIA_ERROR, XmlUrl: "http://feed", Episode: "Episode 1", Url: "http://feed/1.mp3", Err: errors.New("404 Not Found")}
+	diskError := &rss.Error{Kind: rss.DISK_ERROR, XmlUrl: "http://feed", Episode: "Episode 2", Err: errors.New("disk full")}
+	fetchError := &rss.Error{Kind: rss.FETCH_ERROR, XmlUrl: "http://feed", Err: errors.New("timeout")}
+
+	tests := []struct {
+		err      error
+		expected []syncError
+	}{
+		{fetchError, []syncError{{Kind: "fetch", Feed: "http://feed", Message: "timeout"}}},
+		{fmt.Errorf("Planning failed: %w", fetchError), []syncError{{Kind: "fetch", Feed: "http://feed", Message: "timeout"}}},
+		{rss.Errors{mediaError, diskError}, []syncError{
+			{Kind: "media", Feed: "http://feed", Episode: "Episode 1", Url: "http://feed/1.mp3", Message: "404 Not Found"},
+			{Kind: "disk", Feed: "http://feed", Episode: "Episode 2", Message: "disk full"}}},
+		{errors.New("unexpected"), []syncError{{Kind: "parse", Message: "unexpected"}}},
+	}
+
+	for _, test := range tests {
+		if actual := syncErrors(test.err, rss.PARSE_ERROR); !reflect.DeepEqual(test.expected, actual) {
+			t.Errorf("Wrong errors for %v: \n%v\n%v", test.err, test.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package retention
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Episode is a downloaded episode that a Policy may expire.
+type Episode struct {
+	File      string
+	Published time.Time
+	Size      int64
+	// Protected episodes are never expired, for example because they are starred.
+	Protected bool
+}
+
+// Policy decides which episodes are no longer kept.
+type Policy interface {
+	// Expire returns the episodes the policy no longer keeps.  episodes are sorted
+	// newest first.
+	Expire(episodes []*Episode, now time.Time) []*Episode
+}
+
+// KeepNewest keeps the given number of newest episodes.
+type KeepNewest int
+
+func (keep KeepNewest) Expire(episodes []*Episode, now time.Time) []*Episode {
+	if len(episodes) <= int(keep) {
+		return nil
+	}
+	return episodes[keep:]
+}
+
+// MaxAge keeps the episodes published within the given duration.
+type MaxAge time.Duration
+
+func (age MaxAge) Expire(episodes []*Episode, now time.Time) []*Episode {
+	oldest := now.Add(-time.Duration(age))
+	expired := []*Episode{}
+	for _, episode := range episodes {
+		if episode.Published.Before(oldest) {
+			expired = append(expired, episode)
+		}
+	}
+	return expired
+}
+
+// MaxSize keeps the newest episodes whose total size is at most the given number of
+// bytes.  Protected episodes count towards the total.  Once an episode does not fit, it and
+// all older episodes expire, even smaller ones that would still fit.
+type MaxSize int64
+
+func (size MaxSize) Expire(episodes []*Episode, now time.Time) []*Episode {
+	var total int64
+	full := false
+	expired := []*Episode{}
+	for _, episode := range episodes {
+		if !episode.Protected && (full || total+episode.Size > int64(size)) {
+			full = true
+			expired = append(expired, episode)
+		} else {
+			total += episode.Size
+		}
+	}
+	return expired
+}
+
+type newestFirst []*Episode
+
+func (s newestFirst) Len() int {
+	return len(s)
+}
+func (s newestFirst) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+func (s newestFirst) Less(i, j int) bool {
+	return s[i].Published.After(s[j].Published)
+}
+
+// Apply returns the episodes that at least one of the policies expires and that are not
+// protected.  episodes is sorted newest first.
+func Apply(episodes []*Episode, now time.Time, policies ...Policy) []*Episode {
+	sort.Stable(newestFirst(episodes))
+
+	expiredSet := map[*Episode]bool{}
+	for _, policy := range policies {
+		for _, episode := range policy.Expire(episodes, now) {
+			expiredSet[episode] = true
+		}
+	}
+
+	expired := []*Episode{}
+	for _, episode := range episodes {
+		if expiredSet[episode] && !episode.Protected {
+			expired = append(expired, episode)
+		}
+	}
+	return expired
+}
+
+var sizeUnits = []struct {
+	suffix     string
+	multiplier float64
+}{
+	{"kib", 1 << 10}, {"mib", 1 << 20}, {"gib", 1 << 30}, {"tib", 1 << 40},
+	{"kb", 1e3}, {"mb", 1e6}, {"gb", 1e9}, {"tb", 1e12},
+	{"k", 1e3}, {"m", 1e6}, {"g", 1e9}, {"t", 1e12},
+	{"b", 1},
+}
+
+// ParseSize parses a size such as "500MB", "1.5G" or "2GiB" into bytes.
+func ParseSize(size string) (int64, error) {
+	value := strings.ToLower(strings.TrimSpace(size))
+	multiplier := 1.0
+	for _, unit := range sizeUnits {
+		if strings.HasSuffix(value, unit.suffix) {
+			value = strings.TrimSpace(strings.TrimSuffix(value, unit.suffix))
+			multiplier = unit.multiplier
+			break
+		}
+	}
+
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil || number < 0 {
+		return 0, fmt.Errorf("Invalid size %q, expected a number with an optional unit such as MB or GiB", size)
+	}
+	return int64(number * multiplier), nil
+}
+
+// ParseAge parses an age such as "30d", "2w" or "36h".
+func ParseAge(age string) (time.Duration, error) {
+	value := strings.ToLower(strings.TrimSpace(age))
+	unit := time.Duration(0)
+	switch {
+	case strings.HasSuffix(value, "d"):
+		unit = 24 * time.Hour
+	case strings.HasSuffix(value, "w"):
+		unit = 7 * 24 * time.Hour
+	}
+
+	if unit == 0 {
+		duration, err := time.ParseDuration(value)
+		if err != nil || duration < 0 {
+			return 0, fmt.Errorf("Invalid age %q, expected a duration such as 30d, 2w or 36h", age)
+		}
+		return duration, nil
+	}
+
+	number, err := strconv.ParseFloat(value[:len(value)-1], 64)
+	if err != nil || number < 0 {
+		return 0, fmt.Errorf("Invalid age %q, expected a duration such as 30d, 2w or 36h", age)
+	}
+	return time.Duration(number * float64(unit)), nil
+}
@@ -0,0 +1,121 @@
+package retention
+
+import (
+	"testing"
+	"time"
+)
+
+var now = time.Date(2014, 8, 11, 21, 20, 36, 0, time.UTC)
+
+func episodes(ages ...int) []*Episode {
+	result := []*Episode{}
+	for i, age := range ages {
+		result = append(result, &Episode{
+			File:      string('a' + rune(i)),
+			Published: now.Add(-time.Duration(age) * 24 * time.Hour),
+			Size:      100})
+	}
+	return result
+}
+
+func files(episodes []*Episode) string {
+	names := ""
+	for _, episode := range episodes {
+		names += episode.File
+	}
+	return names
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name     string
+		ages     []int
+		policies []Policy
+		expected string
+	}{
+		// the episodes are sorted by publish date, not by their order
+		{"keep newest", []int{3, 1, 4, 2}, []Policy{KeepNewest(2)}, "ac"},
+		{"keep more than available", []int{3, 1}, []Policy{KeepNewest(5)}, ""},
+		{"max age", []int{10, 40, 20, 31}, []Policy{MaxAge(30 * 24 * time.Hour)}, "db"},
+		{"max size", []int{1, 2, 3, 4}, []Policy{MaxSize(250)}, "cd"},
+		{"combined", []int{1, 2, 3, 40}, []Policy{KeepNewest(3), MaxAge(30 * 24 * time.Hour), MaxSize(150)}, "bcd"},
+	}
+
+	for _, test := range tests {
+		expired := Apply(episodes(test.ages...), now, test.policies...)
+		if files(expired) != test.expected {
+			t.Errorf("%s: expected %q to expire but got %q", test.name, test.expected, files(expired))
+		}
+	}
+}
+
+func TestApplyKeepsProtectedEpisodes(t *testing.T) {
+	candidates := episodes(1, 2, 3, 4)
+	candidates[2].Protected = true
+
+	if expired := files(Apply(candidates, now, KeepNewest(1))); expired != "bd" {
+		t.Errorf("Protected episodes must not expire: %q", expired)
+	}
+
+	// the protected episode uses up space so the older episode expires
+	candidates = episodes(1, 2, 3)
+	candidates[0].Protected = true
+	if expired := files(Apply(candidates, now, MaxSize(200))); expired != "c" {
+		t.Errorf("Protected episodes must count towards the size: %q", expired)
+	}
+}
+
+func TestMaxSizeExpiresOlderEpisodesThanTheFirstTooLarge(t *testing.T) {
+	candidates := episodes(1, 2, 3, 4)
+	candidates[1].Size = 500
+	candidates[3].Protected = true
+
+	// c fits the limit but is older than b which does not
+	if expired := files(MaxSize(250).Expire(candidates, now)); expired != "bc" {
+		t.Errorf("Episodes older than the first one that does not fit must expire: %q", expired)
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := map[string]int64{
+		"1024":   1024,
+		"500MB":  500e6,
+		"1.5 G":  1.5e9,
+		"2GiB":   2 << 30,
+		"10 kib": 10 << 10,
+		"42b":    42,
+	}
+	for size, expected := range tests {
+		parsed, err := ParseSize(size)
+		if err != nil || parsed != expected {
+			t.Errorf("ParseSize(%q) = %d, %v but expected %d", size, parsed, err, expected)
+		}
+	}
+
+	for _, size := range []string{"", "MB", "-1GB", "lots"} {
+		if _, err := ParseSize(size); err == nil {
+			t.Errorf("ParseSize(%q) should fail", size)
+		}
+	}
+}
+
+func TestParseAge(t *testing.T) {
+	tests := map[string]time.Duration{
+		"30d":  30 * 24 * time.Hour,
+		"2w":   14 * 24 * time.Hour,
+		"36h":  36 * time.Hour,
+		"1.5d": 36 * time.Hour,
+	}
+	for age, expected := range tests {
+		parsed, err := ParseAge(age)
+		if err != nil || parsed != expected {
+			t.Errorf("ParseAge(%q) = %v, %v but expected %v", age, parsed, err, expected)
+		}
+	}
+
+	for _, age := range []string{"", "d", "-3d", "a month"} {
+		if _, err := ParseAge(age); err == nil {
+			t.Errorf("ParseAge(%q) should fail", age)
+		}
+	}
+}
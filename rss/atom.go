@@ -0,0 +1,111 @@
+package rss
+
+import (
+	"encoding/xml"
+	"gopod/charset"
+	"io"
+	"strings"
+	"time"
+)
+
+// The Atom types are only used for decoding Atom feeds, ParseAtom maps them into the
+// Rss model so the rest of gopod handles both formats the same way.
+type atomFeed struct {
+	Title    string      `xml:"title"`
+	Subtitle string      `xml:"subtitle"`
+	Updated  string      `xml:"updated"`
+	Entries  []atomEntry `xml:"entry"`
+}
+
+type atomEntry struct {
+	Title     string         `xml:"title"`
+	Id        string         `xml:"id"`
+	Published string         `xml:"published"`
+	Updated   string         `xml:"updated"`
+	Summary   string         `xml:"summary"`
+	Content   string         `xml:"content"`
+	Links     []atomLink     `xml:"link"`
+	Category  []atomCategory `xml:"category"`
+}
+
+type atomLink struct {
+	Href   string `xml:"href,attr"`
+	Rel    string `xml:"rel,attr"`
+	Type   string `xml:"type,attr"`
+	Length string `xml:"length,attr"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+// atomDate converts an Atom (RFC 3339) date to the RFC 1123 format used by Rss feeds.
+func atomDate(date string) string {
+	parsed, err := time.Parse(time.RFC3339, strings.TrimSpace(date))
+	if err != nil {
+		return date
+	}
+	return parsed.Format(time.RFC1123Z)
+}
+
+func (entry *atomEntry) item() Item {
+	item := Item{
+		Title:       entry.Title,
+		Description: entry.Summary,
+		PubDate:     atomDate(entry.Published),
+		Guid:        entry.Id}
+
+	if item.Description == "" {
+		item.Description = entry.Content
+	}
+	if entry.Published == "" {
+		item.PubDate = atomDate(entry.Updated)
+	}
+	for _, category := range entry.Category {
+		item.Categories = append(item.Categories, category.Term)
+	}
+
+	for _, link := range entry.Links {
+		switch link.Rel {
+		case "", "alternate":
+			if item.Link == "" {
+				item.Link = link.Href
+			}
+		case "enclosure":
+			if item.Enclosure.Url == "" {
+				item.Enclosure = Enclosure{Url: link.Href, Type: link.Type, Length: link.Length}
+			}
+		}
+	}
+
+	return item
+}
+
+func (feed *atomFeed) rss() *Rss {
+	rss := Rss{Channel{
+		Title:         feed.Title,
+		Description:   feed.Subtitle,
+		LastBuildDate: atomDate(feed.Updated)}}
+
+	for i := range feed.Entries {
+		rss.Channel.Items = append(rss.Channel.Items, feed.Entries[i].item())
+	}
+
+	return &rss
+}
+
+// ParseAtom parses an Atom feed into the Rss model.
+func ParseAtom(reader io.Reader) (*Rss, error) {
+	reader, err := charset.NewReader(reader, "")
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := xml.NewDecoder(reader)
+	var feed atomFeed
+	if err := decoder.Decode(&feed); err != nil {
+		return nil, err
+	}
+
+	return feed.rss(), nil
+}
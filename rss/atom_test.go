@@ -0,0 +1,77 @@
+package rss
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestParseAtom(t *testing.T) {
+	atomBytes, err := ioutil.ReadFile("example.atom.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rss, err := ParseAtom(bytes.NewReader(atomBytes))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rss.Channel.Description != "Technology news in Atom." {
+		t.Errorf("Wrong channel description: \n%q\n%q\n", "Technology news in Atom.", rss.Channel.Description)
+	}
+
+	if rss.Channel.Title != "Atom Tech Show" {
+		t.Errorf("Wrong channel title: \n%q\n%q\n", "Atom Tech Show", rss.Channel.Title)
+	}
+
+	if rss.Channel.LastBuildDate != "Mon, 11 Aug 2014 21:51:56 +0000" {
+		t.Errorf("Wrong channel LastBuildDate: \n%q\n%q\n", "Mon, 11 Aug 2014 21:51:56 +0000", rss.Channel.LastBuildDate)
+	}
+
+	if len(rss.Channel.Items) != 2 {
+		t.Fatalf("Not enough items in channel, expected 2 but got %v", len(rss.Channel.Items))
+	}
+
+	checkItem(t, 0, rss.Channel.Items, Item{
+		Title:       "ATS 12 – Broadwell",
+		Link:        "http://example.org/ats-12",
+		Description: "Today we talk about Broadwell chips.",
+		PubDate:     "Mon, 11 Aug 2014 21:20:36 +0000",
+		Categories:  []string{"Episode"},
+		Guid:        "tag:example.org,2014:ats-12",
+		Enclosure: Enclosure{
+			Url:    "http://example.org/media/ats-12.mp3",
+			Type:   "audio/mpeg",
+			Length: "31457280"}})
+
+	checkItem(t, 1, rss.Channel.Items, Item{
+		Title:       "ATS 11 – Cables",
+		Link:        "http://example.org/ats-11",
+		Description: "A 60 Tb/s cable.",
+		PubDate:     "Sun, 10 Aug 2014 21:20:36 -0700",
+		Guid:        "tag:example.org,2014:ats-11",
+		Enclosure: Enclosure{
+			Url:  "http://example.org/media/ats-11.mp4",
+			Type: "video/mp4"}})
+}
+
+func TestParseFeedDetectsFormat(t *testing.T) {
+	for _, file := range []string{"example.rss.xml", "example.atom.xml"} {
+		feedBytes, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rss, err := ParseFeed(bytes.NewReader(feedBytes))
+		if err != nil {
+			t.Fatalf("Unable to parse %s: %v", file, err)
+		}
+		if len(rss.Channel.Items) == 0 {
+			t.Errorf("No items were parsed from %s", file)
+		}
+	}
+
+	if _, err := ParseFeed(strings.NewReader("<html><body>Not found</body></html>")); err == nil {
+		t.Error("Expected an error when parsing an html document")
+	}
+}
@@ -0,0 +1,224 @@
+package rss
+
+import (
+	"context"
+	"fmt"
+	"gopod/opml"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	DEFAULT_CONNECT_TIMEOUT = 30 * time.Second
+	DEFAULT_READ_TIMEOUT    = 60 * time.Second
+	DEFAULT_RETRIES         = 2
+	DEFAULT_RETRY_DELAY     = 2 * time.Second
+	MAX_RETRY_DELAY         = 5 * time.Minute
+	DEFAULT_USER_AGENT      = "gopod (podcast downloader)"
+
+	// NO_PROXY as the Proxy of the head connects directly even if the environment
+	// configures a proxy.
+	NO_PROXY = "none"
+)
+
+// Client sends the requests for feeds and episodes.  It limits the number of concurrent
+// requests with its Scheduler, retries failed requests and sends the configured headers.
+// A nil *Client uses the defaults.
+type Client struct {
+	http       *http.Client
+	scheduler  *Scheduler
+	userAgent  string
+	retries    int
+	retryDelay time.Duration
+	header     http.Header
+}
+
+// timeoutConn fails reads and writes that make no progress within timeout, unlike the
+// Timeout of http.Client it does not limit the duration of long downloads.
+type timeoutConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (conn *timeoutConn) Read(data []byte) (int, error) {
+	if err := conn.Conn.SetReadDeadline(time.Now().Add(conn.timeout)); err != nil {
+		return 0, err
+	}
+	return conn.Conn.Read(data)
+}
+
+func (conn *timeoutConn) Write(data []byte) (int, error) {
+	if err := conn.Conn.SetWriteDeadline(time.Now().Add(conn.timeout)); err != nil {
+		return 0, err
+	}
+	return conn.Conn.Write(data)
+}
+
+func parseTimeout(name, value string, defaultValue time.Duration) (time.Duration, error) {
+	if value == "" {
+		return defaultValue, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		return 0, fmt.Errorf("%s must be a positive duration such as \"30s\": %q", name, value)
+	}
+	return duration, nil
+}
+
+// NewClient creates a Client with the timeouts, retries, User-Agent, proxy and limits
+// configured in the head of the config file.
+func NewClient(head opml.OpmlHead) (*Client, error) {
+	connectTimeout, err := parseTimeout("ConnectTimeout", head.ConnectTimeout, DEFAULT_CONNECT_TIMEOUT)
+	if err != nil {
+		return nil, err
+	}
+	readTimeout, err := parseTimeout("ReadTimeout", head.ReadTimeout, DEFAULT_READ_TIMEOUT)
+	if err != nil {
+		return nil, err
+	}
+	retryDelay, err := parseTimeout("RetryDelay", head.RetryDelay, DEFAULT_RETRY_DELAY)
+	if err != nil {
+		return nil, err
+	}
+
+	proxy := http.ProxyFromEnvironment
+	switch head.Proxy {
+	case "":
+	case NO_PROXY:
+		proxy = nil
+	default:
+		proxyUrl, err := url.Parse(head.Proxy)
+		if err != nil || proxyUrl.Host == "" {
+			return nil, fmt.Errorf("Proxy must be a url such as \"http://proxy:3128\" or %q: %q", NO_PROXY, head.Proxy)
+		}
+		proxy = http.ProxyURL(proxyUrl)
+	}
+
+	retries := head.Retries
+	if retries == 0 {
+		retries = DEFAULT_RETRIES
+	} else if retries < 0 {
+		retries = 0
+	}
+
+	userAgent := head.UserAgent
+	if userAgent == "" {
+		userAgent = DEFAULT_USER_AGENT
+	}
+
+	dialer := &net.Dialer{Timeout: connectTimeout, KeepAlive: 30 * time.Second}
+	scheduler := NewSchedulerFromHead(head)
+	transport := &http.Transport{
+		Proxy: proxy,
+		DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+			conn, err := dialer.DialContext(ctx, network, address)
+			if err != nil {
+				return nil, err
+			}
+			return &timeoutConn{conn, readTimeout}, nil
+		},
+		TLSHandshakeTimeout:   connectTimeout,
+		ResponseHeaderTimeout: readTimeout,
+		MaxIdleConnsPerHost:   scheduler.maxPerHost}
+
+	return &Client{
+		http:       &http.Client{Transport: transport},
+		scheduler:  scheduler,
+		userAgent:  userAgent,
+		retries:    retries,
+		retryDelay: retryDelay}, nil
+}
+
+var defaultClient, _ = NewClient(opml.OpmlHead{})
+
+func (client *Client) orDefault() *Client {
+	if client == nil {
+		return defaultClient
+	}
+	return client
+}
+
+// MaxDownloads is the number of requests that may run at the same time.
+func (client *Client) MaxDownloads() int {
+	return client.orDefault().scheduler.MaxDownloads()
+}
+
+// acquire blocks until a request to rawUrl may start, see Scheduler.Acquire.
+func (client *Client) acquire(rawUrl string) (release func()) {
+	return client.orDefault().scheduler.Acquire(rawUrl)
+}
+
+// forOutline returns a client that sends the Headers of the outline with every request.
+func (client *Client) forOutline(outline *opml.OpmlOutline) *Client {
+	outlineClient := *client.orDefault()
+	outlineClient.header = http.Header{}
+	for _, header := range outline.Headers {
+		outlineClient.header.Add(header.Name, header.Value)
+	}
+	return &outlineClient
+}
+
+// retryable reports whether a request that failed with err or resp may succeed if it is
+// sent again.
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
+
+// backoff is the delay before retry number attempt: the retry delay doubled for every
+// attempt with up to half of it randomized so that clients do not retry in lockstep.  A
+// longer Retry-After of the response is honored.
+func (client *Client) backoff(attempt int, resp *http.Response) time.Duration {
+	delay := client.retryDelay << uint(attempt)
+	if delay > MAX_RETRY_DELAY || delay <= 0 {
+		delay = MAX_RETRY_DELAY
+	}
+	delay = delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+
+	if resp != nil {
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			if retryAfter := time.Duration(seconds) * time.Second; retryAfter > delay && retryAfter <= MAX_RETRY_DELAY {
+				delay = retryAfter
+			}
+		}
+	}
+	return delay
+}
+
+// do sends a GET request that has no body.  Connection errors, 429 and 5xx responses are
+// retried, the response of the last attempt is returned.  checkRedirect is used as the
+// CheckRedirect of the http.Client if it is not nil.
+func (client *Client) do(request *http.Request, checkRedirect func(*http.Request, []*http.Request) error) (*http.Response, error) {
+	client = client.orDefault()
+
+	request.Header.Set("User-Agent", client.userAgent)
+	for name, values := range client.header {
+		request.Header[name] = values
+	}
+
+	httpClient := *client.http
+	httpClient.CheckRedirect = checkRedirect
+
+	for attempt := 0; ; attempt++ {
+		resp, err := httpClient.Do(request)
+		if attempt >= client.retries || !retryable(resp, err) {
+			return resp, err
+		}
+
+		delay := client.backoff(attempt, resp)
+		if err != nil {
+			log.Printf("Request for %s failed, retrying in %v: %v\n", request.URL, delay, err)
+		} else {
+			log.Printf("Server returned %q for %s, retrying in %v\n", resp.Status, request.URL, delay)
+			resp.Body.Close()
+		}
+		time.Sleep(delay)
+	}
+}
@@ -0,0 +1,121 @@
+package rss
+
+import (
+	"gopod/opml"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientRetriesServerErrors(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	client, err := NewClient(opml.OpmlHead{RetryDelay: "1ms", Retries: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	request, _ := http.NewRequest("GET", server.URL, nil)
+	resp, err := client.do(request, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || requests != 3 {
+		t.Errorf("Expected the third request to succeed: %d after %d requests", resp.StatusCode, requests)
+	}
+}
+
+func TestClientDoesNotRetryClientErrors(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	client, err := NewClient(opml.OpmlHead{RetryDelay: "1ms"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	request, _ := http.NewRequest("GET", server.URL, nil)
+	resp, err := client.do(request, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNotFound || requests != 1 {
+		t.Errorf("Expected a single 404 response: %d after %d requests", resp.StatusCode, requests)
+	}
+}
+
+func TestClientSendsHeaders(t *testing.T) {
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+	}))
+	defer server.Close()
+
+	client, err := NewClient(opml.OpmlHead{UserAgent: "test-agent/1.0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	outline := &opml.OpmlOutline{Headers: []opml.OpmlHeader{{Name: "Authorization", Value: "Bearer secret"}}}
+	request, _ := http.NewRequest("GET", server.URL, nil)
+	resp, err := client.forOutline(outline).do(request, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if header.Get("User-Agent") != "test-agent/1.0" {
+		t.Errorf("Wrong User-Agent: \n%q\n%q", "test-agent/1.0", header.Get("User-Agent"))
+	}
+	if header.Get("Authorization") != "Bearer secret" {
+		t.Errorf("Wrong Authorization: \n%q\n%q", "Bearer secret", header.Get("Authorization"))
+	}
+}
+
+func TestNewClientRejectsInvalidHead(t *testing.T) {
+	for _, head := range []opml.OpmlHead{
+		{ConnectTimeout: "soon"},
+		{ReadTimeout: "-1s"},
+		{RetryDelay: "1"},
+		{Proxy: "not a url"},
+	} {
+		if _, err := NewClient(head); err == nil {
+			t.Errorf("Expected an error for %v", head)
+		}
+	}
+}
+
+func TestNewClientKeepsConnectionsPerHost(t *testing.T) {
+	tests := []struct {
+		head     opml.OpmlHead
+		expected int
+	}{
+		{opml.OpmlHead{}, DEFAULT_MAX_DOWNLOADS_PER_HOST},
+		{opml.OpmlHead{MaxDownloads: 8, MaxDownloadsPerHost: 6}, 6},
+		{opml.OpmlHead{MaxDownloads: 3, MaxDownloadsPerHost: 6}, 3},
+	}
+
+	for _, test := range tests {
+		client, err := NewClient(test.head)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if idle := client.http.Transport.(*http.Transport).MaxIdleConnsPerHost; idle != test.expected {
+			t.Errorf("Wrong MaxIdleConnsPerHost for %+v: \n%d\n%d", test.head, test.expected, idle)
+		}
+	}
+}
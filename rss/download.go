@@ -1,201 +1,395 @@
 package rss
 
 import (
-	"bufio"
-	"bytes"
 	"fmt"
+	"gopod/history"
 	"gopod/opml"
-	"io/ioutil"
 	"log"
-	"net/http"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"time"
-	"regexp"
 )
 
 type ContentType string
 
 const (
-	audio ContentType = "audio"
-	video             = "video"
-	unknown           = "unknown"
+	audio   ContentType = "audio"
+	video               = "video"
+	unknown             = "unknown"
 )
 
-var pathCleanUpRegexp = regexp.MustCompile(`[^a-zA-Z0-9_\-&^!+=\)\(\[\].]`)
-
-func cleanPath(path string) string {
-	cleaned := pathCleanUpRegexp.ReplaceAll([]byte(path), []byte("+"))
-	return string(cleaned)
+// KeepCount is the number of the newest episodes of the outline that are downloaded and
+// kept on disk: the Keep of the outline, the DefaultKeep of the head or 1.
+func KeepCount(head opml.OpmlHead, outline *opml.OpmlOutline) int {
+	if outline.Keep > 0 {
+		return outline.Keep
+	}
+	if head.DefaultKeep > 0 {
+		return head.DefaultKeep
+	}
+	return 1
 }
-func contentTypeToExt(podcastItem Item) (ext string, ctype ContentType, err error) {
 
-	contentType := podcastItem.Enclosure.Type
-
-	if !strings.Contains(contentType, "/") {
-		contentType = podcastItem.Media.Type
+// namingTemplate is the NamingTemplate of the outline, of the head or the default one.
+func namingTemplate(head opml.OpmlHead, outline *opml.OpmlOutline) string {
+	if outline.NamingTemplate != "" {
+		return outline.NamingTemplate
 	}
+	if head.NamingTemplate != "" {
+		return head.NamingTemplate
+	}
+	return DEFAULT_NAMING_TEMPLATE
+}
 
-	if !strings.Contains(contentType, "/") {
-		return "", unknown, fmt.Errorf("Unable to determine the extension of the file")
+// validateNaming checks the naming template and the FilenameMode used for the episodes of
+// the outline so an invalid setting is reported once for the feed rather than per episode.
+func validateNaming(head opml.OpmlHead, outline *opml.OpmlOutline) error {
+	if _, err := ParseFilenameMode(head.FilenameMode); err != nil {
+		return err
 	}
+	return ValidateTemplate(namingTemplate(head, outline))
+}
 
-	parts := strings.Split(contentType, "/")
+// episodeFile returns the path of the file the episode is downloaded to.
+func episodeFile(head opml.OpmlHead, outline *opml.OpmlOutline, rssModel *Rss, podcastItem Item, media mediaType) (podcastFile string, err error) {
+	template := namingTemplate(head, outline)
 
-	switch parts[1] {
-	case "mpeg":
-		fallthrough
-	case "mp3":
-		return "mp3", audio, nil
-	case "mp4":
-		return "mp4", video, nil
+	mode, err := ParseFilenameMode(head.FilenameMode)
+	if err != nil {
+		return "", err
 	}
 
-	return "", unknown, fmt.Errorf("Unable to figure out extension %s", parts[1])
-}
-
-func parseTime(dateString string) (date time.Time, err error) {
-	formats := []string{time.RFC1123Z, time.RFC1123, time.ANSIC, time.UnixDate, time.RubyDate, time.RFC822, time.RFC822Z}
-	for _, format := range formats {
-		date, err = time.Parse(format, dateString)
-		if err == nil {
-			return date, nil
-		}
+	name, err := expandTemplate(template, &episodeName{&rssModel.Channel, &podcastItem, media.ext, media.ctype, mode})
+	if err != nil {
+		return "", err
 	}
 
-	oneYearAgo, _ := time.ParseDuration("-8760h")
-	return time.Now().Add(oneYearAgo), nil
+	return filepath.Join(head.DownloadDir, name), nil
 }
 
-func needsUpdate(item Item, outline *opml.OpmlOutline) bool {
-	pubDate, err := parseTime(item.PubDate)
-	if err != nil {
-		panic(err.Error())
-	}
-	lastUpdate, err := parseTime(outline.LastUpdate)
-	if err != nil {
+// fileUsedByOtherEpisode reports whether a different episode has been or will be
+// downloaded to podcastFile.
+func fileUsedByOtherEpisode(podcastFile, id string, episodes *history.Subscription, pending []history.Episode) bool {
+	if episode := episodes.GetByFile(podcastFile); episode != nil && episode.Guid != id {
 		return true
 	}
-
-	return lastUpdate.Before(pubDate)
+	for _, episode := range pending {
+		if episode.File == podcastFile && episode.Guid != id {
+			return true
+		}
+	}
+	return false
 }
 
-func createPodcastDir(head opml.OpmlHead, rssModel *Rss, podcastItem Item) (podcastDir, ext string, err error) {
+// legacyCleanUpRegexp is how file names were sanitized before they could be configured.
+var legacyCleanUpRegexp = regexp.MustCompile(`[^a-zA-Z0-9_\-&^!+=\)\(\[\].]`)
 
-	ext, contentType, err := contentTypeToExt(podcastItem)
+// legacyEpisodeFile returns the path earlier versions of gopod downloaded the episode to,
+// before file names could be configured and before downloads were recorded in the history,
+// or "" if those versions were unable to download the episode.
+func legacyEpisodeFile(head opml.OpmlHead, rssModel *Rss, podcastItem Item) string {
+	contentType := podcastItem.Enclosure.Type
+	if !strings.Contains(contentType, "/") {
+		contentType = podcastItem.Media.Type
+	}
+	if !strings.Contains(contentType, "/") {
+		return ""
+	}
 
-	if err != nil {
-		return "", "", err
+	var ext string
+	var ctype ContentType
+	switch strings.SplitN(contentType, "/", 2)[1] {
+	case "mpeg", "mp3":
+		ext, ctype = "mp3", audio
+	case "mp4":
+		ext, ctype = "mp4", video
+	default:
+		return ""
 	}
 
-	podcastDir = filepath.Join(head.DownloadDir, string(contentType), cleanPath(rssModel.Channel.Title))
+	clean := func(name string) string {
+		return legacyCleanUpRegexp.ReplaceAllString(name, "+")
+	}
+	return filepath.Join(head.DownloadDir, string(ctype), clean(rssModel.Channel.Title), clean(podcastItem.Title)+"."+ext)
+}
 
-	err = os.MkdirAll(podcastDir, os.ModeDir)
+// isDownloaded reports whether file exists and is not empty.
+func isDownloaded(file string) bool {
+	fi, err := os.Stat(file)
+	return err == nil && fi.Size() > 0
+}
 
+// UpdateOutline copies the channel information of the feed into the outline.  The
+// DirectoryName is sanitized for the FilenameMode of the head like the {channel} of the
+// naming templates.
+func UpdateOutline(head opml.OpmlHead, outline *opml.OpmlOutline, rssModel *Rss) {
+	mode, err := ParseFilenameMode(head.FilenameMode)
 	if err != nil {
-		return "", "", fmt.Errorf("Failed to make podcast directory %q", podcastDir)
+		// the invalid mode is reported when the episodes are named
+		mode = POSIX_NAMES
 	}
 
+	outline.Title = rssModel.Channel.Title
+	outline.DirectoryName = sanitizeName(rssModel.Channel.Title, mode)
+}
 
-	return podcastDir, ext, nil
+// Plan is the result of fetching the feed of a subscription: the episodes that will be
+// downloaded and the updates of the outline.  Fetching the feed only changes the outline
+// and the history of the subscription, nothing is written to disk until Execute is called.
+type Plan struct {
+	// Episodes are the episodes that Execute downloads.  The File of an episode whose media
+	// type is unknown until it is downloaded is provisional.
+	Episodes []history.Episode
+	// Warnings are the problems of a feed that is not well-formed that were recovered from.
+	Warnings []string
+	// Skipped are the newest episodes that the filter of the outline excluded.
+	Skipped []Skipped
+	// Errors are the episodes that cannot be downloaded because their file name could not
+	// be determined.
+	Errors Errors
+
+	// resolvers name the files of the episodes with a provisional File by their guid
+	resolvers          map[string]func(mediaType) (string, error)
+	client             *Client
+	outline            *opml.OpmlOutline
+	history            *history.Subscription
+	etag, lastModified string
+	lastUpdate         string
+	// movedTo is the url the feed moved to, see Move
+	movedTo, moveReason string
 }
 
-func Download(head opml.OpmlHead, outline *opml.OpmlOutline) (numEpisodesDownloaded int, err error) {
-	log.Printf("Downloading Rss feed from %q\n", outline.XmlUrl)
-	resp, err := http.Get(outline.XmlUrl)
+// PlanDownload fetches the feed of the outline and determines the newest episodes that
+// are not yet in the history of the subscription.  The feed is fetched when the scheduler
+// of the client allows it.  The outline is updated with the channel information of the
+// feed and episodes whose file already exists are recorded in the history.  The media
+// type of an episode is declared by the feed or implied by its url, otherwise it is
+// determined from the content when the episode is downloaded.  Episodes whose file cannot
+// be named are recorded in the Errors of the plan and do not keep the other episodes from
+// being downloaded.  Invalid naming and filter settings are a CONFIG_ERROR of the feed,
+// reported before the feed is fetched.  A feed that moved is only moved by Move.
+func PlanDownload(head opml.OpmlHead, outline *opml.OpmlOutline, episodes *history.Subscription, client *Client) (*Plan, error) {
+	if err := validateNaming(head, outline); err != nil {
+		return nil, &Error{Kind: CONFIG_ERROR, XmlUrl: outline.XmlUrl, Err: err}
+	}
+	episodeFilter, err := newFilter(outline.Filter)
 	if err != nil {
-		return 0, err
+		return nil, &Error{Kind: CONFIG_ERROR, XmlUrl: outline.XmlUrl, Err: err}
 	}
 
-	value := resp.Body
-	defer value.Close()
-
-	rssFeedText, err := ioutil.ReadAll(value)
-	rssModel, err := ParseRss(bytes.NewReader(rssFeedText))
-
+	client = client.forOutline(outline)
+	plan := &Plan{
+		resolvers:    map[string]func(mediaType) (string, error){},
+		client:       client,
+		outline:      outline,
+		history:      episodes,
+		etag:         outline.ETag,
+		lastModified: outline.LastModified,
+		lastUpdate:   outline.LastUpdate}
+
+	release := client.acquire(outline.XmlUrl)
+	feed, err := fetchRss(client, outline.XmlUrl, outline.ETag, outline.LastModified)
+	release()
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
-	outline.Title = rssModel.Channel.Title
-	outline.DirectoryName = cleanPath(rssModel.Channel.Title)
+	if feed.movedTo != "" {
+		plan.movedTo, plan.moveReason = feed.movedTo, "the server permanently redirected the feed"
+	}
 
-	podcastItems := rssModel.Channel.Items
+	if feed.notModified {
+		log.Printf("Podcast %q is update to date, the feed has not been modified", outline.Title)
+		return plan, nil
+	}
 
-	if len(podcastItems) == 0 {
-		return 0, nil
+	rssModel := feed.rss
+	plan.Warnings = feed.warnings
+	for _, warning := range feed.warnings {
+		log.Printf("Warning for %s: %s\n", outline.XmlUrl, warning)
 	}
+	plan.etag, plan.lastModified = feed.header.Get("ETag"), feed.header.Get("Last-Modified")
 
-	if !needsUpdate(podcastItems[0], outline) {
-		log.Printf("Podcast %q is update to date", rssModel.Channel.Title)
-		return 0, nil
+	if newFeedUrl := strings.TrimSpace(rssModel.Channel.NewFeedUrl); newFeedUrl != "" && newFeedUrl != outline.XmlUrl {
+		if isFeedUrl(newFeedUrl) {
+			plan.movedTo, plan.moveReason = newFeedUrl, "the feed declares a new-feed-url"
+			// the validators belong to the old feed
+			plan.etag, plan.lastModified = "", ""
+		} else {
+			log.Printf("Ignoring invalid new-feed-url %q of %q\n", newFeedUrl, outline.XmlUrl)
+		}
 	}
 
-	downloadCount := 0
-	keep := outline.Keep
-	if keep == 0 {
-		keep = head.DefaultKeep
+	UpdateOutline(head, outline, rssModel)
+
+	podcastItems, skipped, selectionWarnings := selectEpisodes(rssModel.Channel.Items, KeepCount(head, outline), episodeFilter)
+	for _, episode := range skipped {
+		log.Printf("Skipping %q of %q, the %s\n", episode.Title, outline.Title, episode.Reason)
 	}
-	if keep == 0 {
-		keep = 1
+	plan.Skipped = skipped
+	for _, warning := range selectionWarnings {
+		log.Printf("Warning for %s: %s\n", outline.XmlUrl, warning)
 	}
+	plan.Warnings = append(plan.Warnings, selectionWarnings...)
 
-	for i := 0; i < keep; i++ {
-		podcastItem := podcastItems[i]
-		var postcastUrl string
-		if postcastUrl = podcastItem.Enclosure.Url; len(postcastUrl) > 0 {
-			postcastUrl = postcastUrl
-		} else if postcastUrl = podcastItem.Media.Url; len(postcastUrl) > 0 {
-			postcastUrl = postcastUrl
-		} else {
-			return 0, fmt.Errorf("No url was found for this podcast: %q\n", rssModel.Channel.Title)
+	if len(podcastItems) == 0 {
+		return plan, nil
+	}
+	plan.lastUpdate = podcastItems[0].PubDate
+
+	for _, podcastItem := range podcastItems {
+		postcastUrl := podcastItem.MediaUrl()
+
+		if episode := episodes.Get(podcastItem.Id()); episode != nil {
+			log.Printf("Podcast was downloaded on %s, Skipping download of %s\n", episode.Downloaded, podcastItem.Title)
+			continue
 		}
 
-		podcastDir, ext, err := createPodcastDir(head, rssModel, podcastItem)
+		media, err := itemMediaType(podcastItem)
 		if err != nil {
-			return downloadCount, err
+			log.Printf("%v, the media type of %s is determined when it is downloaded\n", err, podcastItem.Title)
+			item := podcastItem
+			plan.resolvers[item.Id()] = func(media mediaType) (string, error) {
+				podcastFile, err := episodeFile(head, outline, rssModel, item, media)
+				if err == nil && fileUsedByOtherEpisode(podcastFile, item.Id(), episodes, nil) {
+					podcastFile = disambiguateName(podcastFile, item.Id())
+				}
+				return podcastFile, err
+			}
+			media = unknownMedia
 		}
 
-		podcastFile := filepath.Join(podcastDir, cleanPath(podcastItem.Title)+"."+ext)
+		podcastFile, err := episodeFile(head, outline, rssModel, podcastItem, media)
+		if err != nil {
+			log.Printf("Unable to name the file of %s: %v\n", podcastItem.Title, err)
+			plan.Errors = append(plan.Errors, &Error{Kind: DISK_ERROR, XmlUrl: outline.XmlUrl, Episode: podcastItem.Title, Url: postcastUrl, Err: err})
+			continue
+		}
+		if fileUsedByOtherEpisode(podcastFile, podcastItem.Id(), episodes, plan.Episodes) {
+			podcastFile = disambiguateName(podcastFile, podcastItem.Id())
+		}
 
-		fi, err := os.Stat(podcastFile)
+		episode := history.Episode{
+			Guid:    podcastItem.Id(),
+			Title:   podcastItem.Title,
+			PubDate: podcastItem.PubDate,
+			Url:     postcastUrl,
+			File:    podcastFile,
+			Length:  podcastItem.Enclosure.length()}
+
+		if !isDownloaded(episode.File) {
+			legacyFile := legacyEpisodeFile(head, rssModel, podcastItem)
+			if legacyFile != "" && isDownloaded(legacyFile) && episodes.GetByFile(legacyFile) == nil {
+				log.Printf("Recording %s downloaded by an earlier version of gopod as %s\n", legacyFile, podcastItem.Title)
+				episode.File = legacyFile
+			}
+		}
 
-		if os.IsExist(err) && fi.Size() > 0 {
+		if isDownloaded(episode.File) {
 			log.Printf("Podcast has been previously downloaded, Skipping download of %s\n", podcastItem.Title)
+			episode.Downloaded = time.Now().Format(time.RFC3339)
+			episodes.Add(episode)
 		} else {
+			plan.Episodes = append(plan.Episodes, episode)
+		}
+	}
 
-			dest, err := os.Create(podcastFile)
-			defer dest.Close()
+	return plan, nil
+}
 
-			if err != nil {
-				return downloadCount, fmt.Errorf("Unable to create file for podcast: %v", podcastItem)
+// Execute downloads the episodes of the plan concurrently and records them in the history.
+// The cache validators of the feed are only recorded in the outline once all episodes have
+// been downloaded so a failed run is retried in full the next time.  The error is Errors
+// with an error for every episode that failed, including the ones that could not be planned.
+func (plan *Plan) Execute() (numEpisodesDownloaded int, err error) {
+	pending := plan.Episodes
+
+	done := make(chan *Error)
+	for i := range pending {
+		go func(episode *history.Episode) {
+			release := plan.client.acquire(episode.Url)
+			defer release()
+
+			episodeError := &Error{XmlUrl: plan.outline.XmlUrl, Episode: episode.Title, Url: episode.Url}
+
+			podcastDir := filepath.Dir(episode.File)
+			if err := os.MkdirAll(podcastDir, 0755); err != nil {
+				episodeError.Kind, episodeError.Err = DISK_ERROR, fmt.Errorf("Failed to make podcast directory %q: %v", podcastDir, err)
+				done <- episodeError
+				return
 			}
 
-
-
-			log.Printf("Downloading podcast: %q from url %q\n", podcastItem.Title, postcastUrl)
-			resp, err = http.Get(postcastUrl)
-
+			log.Printf("Downloading podcast: %q from url %q\n", episode.Title, episode.Url)
+			file, n, err := downloadEpisode(plan.client, episode.Url, episode.File, episode.Length, plan.resolvers[episode.Guid])
 			if err != nil {
 				log.Printf("An error occurred downloading podcast: '%v'\n\n", err)
-				return downloadCount, err
+				episodeError.Kind, episodeError.Err = downloadErrorKind(err), err
+				done <- episodeError
+				return
 			}
 
-			podcast := resp.Body
-			defer podcast.Close()
+			episode.File = file
+			log.Printf("Downloaded file with size: %d to %s\n", n, episode.File)
+			episode.Downloaded = time.Now().Format(time.RFC3339)
+			done <- nil
+		}(&pending[i])
+	}
 
-			n, err := bufio.NewReader(podcast).WriteTo(dest)
-			if err != nil {
-				return downloadCount, fmt.Errorf("Failed to copy %v to %v due to %v", podcastItem.Title, dest, err)
-			}
+	errs := append(Errors{}, plan.Errors...)
+	for range pending {
+		if episodeError := <-done; episodeError != nil {
+			errs = append(errs, episodeError)
+		}
+	}
 
-			log.Printf("Downloaded file with size: %d to %s\n", n, dest.Name())
+	downloadCount := 0
+	for _, episode := range pending {
+		if episode.Downloaded != "" {
+			plan.history.Add(episode)
+			downloadCount++
 		}
-		downloadCount++
 	}
 
-	outline.LastUpdate = podcastItems[0].PubDate
+	if len(errs) > 0 {
+		return downloadCount, errs
+	}
+
+	plan.outline.ETag = plan.etag
+	plan.outline.LastModified = plan.lastModified
+	plan.outline.LastUpdate = plan.lastUpdate
 
 	return downloadCount, nil
 }
+
+// Pretend records the episodes of the plan in the history and updates the outline as if
+// Execute had downloaded them, without downloading anything.  It is used to preview a sync
+// and returns the errors of the episodes that could not be planned like Execute.
+func (plan *Plan) Pretend() error {
+	downloaded := time.Now().Format(time.RFC3339)
+	for _, episode := range plan.Episodes {
+		episode.Downloaded = downloaded
+		plan.history.Add(episode)
+	}
+
+	if len(plan.Errors) > 0 {
+		return plan.Errors
+	}
+
+	plan.outline.ETag = plan.etag
+	plan.outline.LastModified = plan.lastModified
+	plan.outline.LastUpdate = plan.lastUpdate
+	return nil
+}
+
+// Download downloads the newest episodes of the subscription that are not yet in its
+// history and records them in the history.  The feed and the episodes are fetched when
+// the scheduler of the client allows it, the episodes are downloaded concurrently.
+func Download(head opml.OpmlHead, outline *opml.OpmlOutline, episodes *history.Subscription, client *Client) (numEpisodesDownloaded int, err error) {
+	plan, err := PlanDownload(head, outline, episodes, client)
+	if err != nil {
+		return 0, err
+	}
+	return plan.Execute()
+}
@@ -2,19 +2,37 @@ package rss
 
 import (
 	"fmt"
+	"gopod/history"
 	"gopod/opml"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
-func servers(rssModel string) (*httptest.Server, *httptest.Server) {
-	mp3Server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		fmt.Fprintln(w, "This is a fake podcast")
+const (
+	fakePodcast     = "This is a fake podcast\n"
+	fakePodcastETag = `"fake-podcast-v1"`
+)
+
+// mediaServer serves fakePodcast with an ETag and supports Range and If-Range requests.
+// The Range header of every request is appended to ranges.
+func mediaServer(ranges *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ranges != nil {
+			*ranges = append(*ranges, r.Header.Get("Range"))
+		}
+		w.Header().Set("ETag", fakePodcastETag)
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(fakePodcast))
 	}))
+}
+
+func servers(rssModel string) (*httptest.Server, *httptest.Server) {
+	mp3Server := mediaServer(nil)
 
 	rssServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprintln(w, fmt.Sprintf(rssModel, mp3Server.URL))
@@ -23,12 +41,13 @@ func servers(rssModel string) (*httptest.Server, *httptest.Server) {
 	return mp3Server, rssServer
 }
 
-func download(updateRss func(Rss), outline *opml.OpmlOutline) (rss Rss, downloadDir string, numDownloaded int, err error) {
+func download(updateRss func(Rss), outline *opml.OpmlOutline, episodes *history.Subscription) (rss Rss, downloadDir string, numDownloaded int, err error) {
 	rssModel := Rss{
 		Channel{
 			Title: "Test Podcast",
 			Items: []Item{{
 				Title:   "Podcast Item 1",
+				Guid:    "podcast-item-1",
 				PubDate: "Mon, 11 Aug 2014 21:20:36 +0000"}}}}
 
 	rssModel.Channel.Items[0].Enclosure.Type = "audio/mpeg"
@@ -47,17 +66,18 @@ func download(updateRss func(Rss), outline *opml.OpmlOutline) (rss Rss, download
 
 	head := opml.OpmlHead{DownloadDir: downloadDir}
 	outline.XmlUrl = rssServer.URL
-	numEpisodesDownloaded, err := Download(head, outline)
+	numEpisodesDownloaded, err := Download(head, outline, episodes, nil)
 
 	return rssModel, downloadDir, numEpisodesDownloaded, err
 }
 
 func Test_DownloadEnclosureHasUrl(t *testing.T) {
 	outline := &opml.OpmlOutline{LastUpdate: "Mon, 10 Aug 2014 21:20:36 +0000"}
+	episodes := &history.Subscription{}
 
 	rssModel, downloadDir, downloaded, err := download(func(rssModel Rss) {
 		rssModel.Channel.Items[0].Enclosure.Url = "%s"
-	}, outline)
+	}, outline, episodes)
 
 	if err != nil {
 		t.Fatal(err)
@@ -67,7 +87,7 @@ func Test_DownloadEnclosureHasUrl(t *testing.T) {
 		t.Errorf("Expected 1 episode to be downloaded: %d", downloaded)
 	}
 
-	downloadDirFile, err := os.Open(filepath.Join(downloadDir, rssModel.Channel.Title))
+	downloadDirFile, err := os.Open(filepath.Join(downloadDir, string(audio), sanitizeName(rssModel.Channel.Title, POSIX_NAMES)))
 	if err != nil {
 		t.Fatalf("Unable to open in download directory: %v", err)
 	}
@@ -91,6 +111,14 @@ func Test_DownloadEnclosureHasUrl(t *testing.T) {
 	if outline.LastUpdate != items[0].PubDate {
 		t.Errorf("outline last update was not updated. Expected %q but got %q", outline.LastUpdate, items[0].PubDate)
 	}
+
+	episode := episodes.Get(items[0].Guid)
+	if episode == nil {
+		t.Fatalf("Downloaded episode was not recorded in the history: %v", episodes.Episodes)
+	}
+	if episode.File != filepath.Join(downloadDirFile.Name(), files[0].Name()) {
+		t.Errorf("Wrong file recorded in the history: %q", episode.File)
+	}
 }
 
 func Test_DownloadMediaHasUrl(t *testing.T) {
@@ -98,7 +126,7 @@ func Test_DownloadMediaHasUrl(t *testing.T) {
 
 	rssModel, downloadDir, downloaded, err := download(func(rssModel Rss) {
 		rssModel.Channel.Items[0].Media.Url = "%s"
-	}, outline)
+	}, outline, &history.Subscription{})
 
 	if err != nil {
 		t.Fatal(err)
@@ -108,7 +136,7 @@ func Test_DownloadMediaHasUrl(t *testing.T) {
 		t.Errorf("Expected 1 episode to be downloaded: %d", downloaded)
 	}
 
-	downloadDirFile, err := os.Open(filepath.Join(downloadDir, rssModel.Channel.Title))
+	downloadDirFile, err := os.Open(filepath.Join(downloadDir, string(audio), sanitizeName(rssModel.Channel.Title, POSIX_NAMES)))
 	if err != nil {
 		t.Fatalf("Unable to open in download directory: %v", err)
 	}
@@ -119,7 +147,7 @@ func Test_DownloadMediaHasUrl(t *testing.T) {
 	}
 
 	if files[0].Size() == 0 {
-		t.Error("No data was written to file %q", files[0].Name())
+		t.Errorf("No data was written to file %q", files[0].Name())
 	}
 
 	if filepath.Ext(files[0].Name()) != ".mp3" {
@@ -129,11 +157,12 @@ func Test_DownloadMediaHasUrl(t *testing.T) {
 
 func Test_DownloadIsUpToDate(t *testing.T) {
 	outline := &opml.OpmlOutline{}
+	episodes := &history.Subscription{}
 
 	rssModel, downloadDir, downloaded, err := download(func(rssModel Rss) {
 		rssModel.Channel.Items[0].Media.Url = "%s"
-		outline.LastUpdate = rssModel.Channel.Items[0].PubDate
-	}, outline)
+		episodes.Add(history.Episode{Guid: rssModel.Channel.Items[0].Guid})
+	}, outline, episodes)
 
 	if err != nil {
 		t.Fatal(err)
@@ -143,8 +172,570 @@ func Test_DownloadIsUpToDate(t *testing.T) {
 		t.Errorf("Expected 0 episodes to be downloaded: %d", downloaded)
 	}
 
-	_, err = os.Open(filepath.Join(downloadDir, rssModel.Channel.Title))
-	if os.IsExist(err) {
+	_, err = os.Stat(filepath.Join(downloadDir, string(audio), sanitizeName(rssModel.Channel.Title, POSIX_NAMES)))
+	if !os.IsNotExist(err) {
 		t.Fatalf("Should not have created the podcast dir if no files were downloaded: %v", err)
 	}
 }
+
+func Test_FetchRssAndUpdateOutline(t *testing.T) {
+	rssModel := Rss{Channel{Title: "Test: Podcast/Feed"}}
+	mp3Server, rssServer := servers(rssModel.String())
+	defer mp3Server.Close()
+	defer rssServer.Close()
+
+	fetched, err := FetchRss(nil, rssServer.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	outline := &opml.OpmlOutline{XmlUrl: rssServer.URL}
+	UpdateOutline(opml.OpmlHead{}, outline, fetched)
+
+	if outline.Title != rssModel.Channel.Title {
+		t.Errorf("Wrong outline title: \n%q\n%q", rssModel.Channel.Title, outline.Title)
+	}
+	if outline.DirectoryName != sanitizeName(rssModel.Channel.Title, POSIX_NAMES) {
+		t.Errorf("Wrong outline directory name: \n%q\n%q", sanitizeName(rssModel.Channel.Title, POSIX_NAMES), outline.DirectoryName)
+	}
+
+	UpdateOutline(opml.OpmlHead{FilenameMode: "fat"}, outline, fetched)
+	if outline.DirectoryName != sanitizeName(rssModel.Channel.Title, FAT_NAMES) {
+		t.Errorf("Wrong outline directory name in fat mode: \n%q\n%q", sanitizeName(rssModel.Channel.Title, FAT_NAMES), outline.DirectoryName)
+	}
+}
+
+func Test_PlanDownloadAdoptsLegacyFiles(t *testing.T) {
+	rssModel := Rss{
+		Channel{
+			Title: "Foo Bar",
+			Items: []Item{{
+				Title:     "Episode 1",
+				Guid:      "episode-1",
+				PubDate:   "Mon, 11 Aug 2014 21:20:36 +0000",
+				Enclosure: Enclosure{Url: "%s", Type: "audio/mpeg"}}}}}
+
+	mp3Server, rssServer := servers(rssModel.String())
+	defer mp3Server.Close()
+	defer rssServer.Close()
+
+	downloadDir, err := ioutil.TempDir("", "podcasts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(downloadDir)
+
+	legacyFile := filepath.Join(downloadDir, "audio", "Foo+Bar", "Episode+1.mp3")
+	if err := os.MkdirAll(filepath.Dir(legacyFile), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(legacyFile, []byte("podcast"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	episodes := &history.Subscription{}
+	plan, err := PlanDownload(opml.OpmlHead{DownloadDir: downloadDir}, &opml.OpmlOutline{XmlUrl: rssServer.URL}, episodes, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(plan.Episodes) != 0 {
+		t.Errorf("The episode downloaded by an earlier version should not be downloaded again: %v", plan.Episodes)
+	}
+	if episode := episodes.Get("episode-1"); episode == nil || episode.File != legacyFile {
+		t.Errorf("The legacy file was not recorded in the history: %v", episodes.Episodes)
+	}
+}
+
+func partialDownload(t *testing.T, partial, etag string) (podcastFile string, ranges []string) {
+	server := mediaServer(&ranges)
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "podcasts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	podcastFile = filepath.Join(dir, "episode.mp3")
+
+	if err := ioutil.WriteFile(podcastFile+partExt, []byte(partial), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(podcastFile+partExt+etagExt, []byte(etag), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := downloadEpisode(nil, server.URL, podcastFile, 0, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(podcastFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != fakePodcast {
+		t.Errorf("Downloaded podcast has wrong content: \n%q\n%q", fakePodcast, string(data))
+	}
+	if _, err := os.Stat(podcastFile + partExt); !os.IsNotExist(err) {
+		t.Errorf("Part file was not removed: %v", err)
+	}
+	if _, err := os.Stat(podcastFile + partExt + etagExt); !os.IsNotExist(err) {
+		t.Errorf("ETag file was not removed: %v", err)
+	}
+
+	return podcastFile, ranges
+}
+
+func Test_DownloadEpisodeResumesPartialFile(t *testing.T) {
+	_, ranges := partialDownload(t, fakePodcast[:10], fakePodcastETag)
+
+	if len(ranges) != 1 || ranges[0] != "bytes=10-" {
+		t.Errorf("Expected a single request for bytes=10- but got %q", ranges)
+	}
+}
+
+func Test_DownloadEpisodeRestartsWhenETagChanged(t *testing.T) {
+	// the server ignores the range because If-Range does not match and sends the full file
+	_, ranges := partialDownload(t, "Stale data", `"fake-podcast-v0"`)
+
+	if len(ranges) != 1 || ranges[0] != "bytes=10-" {
+		t.Errorf("Expected a single request for bytes=10- but got %q", ranges)
+	}
+}
+
+func Test_DownloadEpisodeRestartsWithoutETag(t *testing.T) {
+	_, ranges := partialDownload(t, "Stale data", "")
+
+	if len(ranges) != 1 || ranges[0] != "" {
+		t.Errorf("Expected a single request without a range but got %q", ranges)
+	}
+}
+
+func Test_DownloadSendsConditionalRequest(t *testing.T) {
+	mp3Server := mediaServer(nil)
+	defer mp3Server.Close()
+
+	rssModel := Rss{Channel{Title: "Test Podcast", Items: []Item{{Title: "Podcast Item 1", PubDate: "Mon, 11 Aug 2014 21:20:36 +0000"}}}}
+	rssModel.Channel.Items[0].Enclosure = Enclosure{Url: mp3Server.URL, Type: "audio/mpeg"}
+
+	const etag, lastModified = `"feed-v1"`, "Mon, 11 Aug 2014 21:20:36 GMT"
+	fullResponses := 0
+	rssServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == etag && r.Header.Get("If-Modified-Since") == lastModified {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		fullResponses++
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Last-Modified", lastModified)
+		rssModel.Write(w)
+	}))
+	defer rssServer.Close()
+
+	downloadDir, err := ioutil.TempDir("", "podcasts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	head := opml.OpmlHead{DownloadDir: downloadDir}
+	outline := &opml.OpmlOutline{XmlUrl: rssServer.URL}
+
+	if downloaded, err := Download(head, outline, &history.Subscription{}, nil); err != nil || downloaded != 1 {
+		t.Fatalf("Expected 1 episode to be downloaded: %d, %v", downloaded, err)
+	}
+	if outline.ETag != etag || outline.LastModified != lastModified {
+		t.Fatalf("Cache validators were not recorded: %q, %q", outline.ETag, outline.LastModified)
+	}
+
+	// remove the episode so a second full download would be detectable
+	os.RemoveAll(downloadDir)
+	if downloaded, err := Download(head, outline, &history.Subscription{}, nil); err != nil || downloaded != 0 {
+		t.Fatalf("Expected 0 episodes to be downloaded: %d, %v", downloaded, err)
+	}
+	if fullResponses != 1 {
+		t.Errorf("Expected the feed to be sent once but it was sent %d times", fullResponses)
+	}
+	if outline.ETag != etag {
+		t.Errorf("Cache validators should be kept when the feed is not modified: %q", outline.ETag)
+	}
+}
+
+func Test_DownloadIsUpToDateWithoutGuid(t *testing.T) {
+	outline := &opml.OpmlOutline{}
+	episodes := &history.Subscription{}
+
+	// the feed has no guids so the media url identifies the episode
+	mp3Server := mediaServer(nil)
+	defer mp3Server.Close()
+	episodes.Add(history.Episode{Guid: mp3Server.URL})
+
+	_, _, downloaded, err := download(func(rssModel Rss) {
+		rssModel.Channel.Items[0].Guid = ""
+		rssModel.Channel.Items[0].Enclosure.Url = mp3Server.URL
+	}, outline, episodes)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if downloaded != 0 {
+		t.Errorf("Expected 0 episodes to be downloaded: %d", downloaded)
+	}
+}
+
+func movedFeedServer(status int, rssModel Rss) (server *httptest.Server, newUrl string) {
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/old.xml" {
+			http.Redirect(w, r, "/new.xml", status)
+			return
+		}
+		rssModel.Write(w)
+	}))
+	return server, server.URL + "/new.xml"
+}
+
+// planAndMove plans the download of the outline, the only one of the config, and moves it.
+func planAndMove(t *testing.T, outline *opml.OpmlOutline, episodes *history.Subscription) bool {
+	plan, err := PlanDownload(opml.OpmlHead{}, outline, episodes, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	configModel := opml.New()
+	configModel.Body.Outline = []opml.OpmlOutline{*outline}
+	return plan.Move(&configModel, &history.History{Subscriptions: []*history.Subscription{episodes}})
+}
+
+func Test_DownloadFollowsPermanentRedirect(t *testing.T) {
+	for _, status := range []int{http.StatusMovedPermanently, http.StatusPermanentRedirect, http.StatusFound, http.StatusTemporaryRedirect} {
+		server, newUrl := movedFeedServer(status, Rss{Channel{Title: "Moved Podcast"}})
+
+		oldUrl := server.URL + "/old.xml"
+		outline := &opml.OpmlOutline{XmlUrl: oldUrl}
+		episodes := &history.Subscription{XmlUrl: oldUrl}
+		planAndMove(t, outline, episodes)
+		server.Close()
+
+		expectedUrl := oldUrl
+		if status == http.StatusMovedPermanently || status == http.StatusPermanentRedirect {
+			expectedUrl = newUrl
+		}
+		if outline.XmlUrl != expectedUrl || episodes.XmlUrl != expectedUrl {
+			t.Errorf("Wrong url after a %d redirect, expected %q but got %q and %q", status, expectedUrl, outline.XmlUrl, episodes.XmlUrl)
+		}
+	}
+}
+
+func Test_DownloadHonorsNewFeedUrl(t *testing.T) {
+	rssModel := Rss{Channel{Title: "Moved Podcast", NewFeedUrl: "http://example.org/new-feed.xml"}}
+	mp3Server, rssServer := servers(rssModel.String())
+	defer mp3Server.Close()
+	defer rssServer.Close()
+
+	outline := &opml.OpmlOutline{XmlUrl: rssServer.URL}
+	episodes := &history.Subscription{XmlUrl: rssServer.URL}
+	if !planAndMove(t, outline, episodes) {
+		t.Errorf("Move should report that the subscription moved")
+	}
+
+	if outline.XmlUrl != rssModel.Channel.NewFeedUrl || episodes.XmlUrl != rssModel.Channel.NewFeedUrl {
+		t.Errorf("Subscription was not moved to the new-feed-url: %q, %q", outline.XmlUrl, episodes.XmlUrl)
+	}
+}
+
+func Test_MoveKeepsSubscriptionsApart(t *testing.T) {
+	newUrl := "http://example.org/new-feed.xml"
+	rssModel := Rss{Channel{Title: "Moved Podcast", NewFeedUrl: newUrl}}
+	mp3Server, rssServer := servers(rssModel.String())
+	defer mp3Server.Close()
+	defer rssServer.Close()
+
+	tests := []struct {
+		name         string
+		outlines     []opml.OpmlOutline
+		subscription string
+	}{
+		{"outline", []opml.OpmlOutline{{XmlUrl: rssServer.URL}, {XmlUrl: newUrl}}, ""},
+		{"history", []opml.OpmlOutline{{XmlUrl: rssServer.URL}}, newUrl},
+	}
+
+	for _, test := range tests {
+		configModel := opml.New()
+		configModel.Body.Outline = test.outlines
+		historyModel := history.New()
+		episodes := historyModel.Subscription(rssServer.URL)
+		if test.subscription != "" {
+			historyModel.Subscription(test.subscription).Add(history.Episode{Guid: "earlier"})
+		}
+
+		outline := &configModel.Body.Outline[0]
+		plan, err := PlanDownload(opml.OpmlHead{}, outline, episodes, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if plan.Move(&configModel, historyModel) {
+			t.Errorf("%s: the subscription was moved to a url that is in use", test.name)
+		}
+		if outline.XmlUrl != rssServer.URL || episodes.XmlUrl != rssServer.URL {
+			t.Errorf("%s: wrong url after the move was refused: %q, %q", test.name, outline.XmlUrl, episodes.XmlUrl)
+		}
+	}
+}
+
+func Test_PlanDownloadDoesNotWriteToDisk(t *testing.T) {
+	rssModel := Rss{
+		Channel{
+			Title: "Test Podcast",
+			Items: []Item{{
+				Title:     "Podcast Item 1",
+				Guid:      "podcast-item-1",
+				PubDate:   "Mon, 11 Aug 2014 21:20:36 +0000",
+				Enclosure: Enclosure{Url: "%s", Type: "audio/mpeg"}}}}}
+
+	mp3Server, rssServer := servers(rssModel.String())
+	defer mp3Server.Close()
+	defer rssServer.Close()
+
+	tempDir, err := ioutil.TempDir("", "podcasts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+	downloadDir := filepath.Join(tempDir, "downloads")
+
+	outline := &opml.OpmlOutline{XmlUrl: rssServer.URL}
+	episodes := &history.Subscription{}
+	plan, err := PlanDownload(opml.OpmlHead{DownloadDir: downloadDir}, outline, episodes, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(plan.Episodes) != 1 || plan.Episodes[0].Guid != "podcast-item-1" {
+		t.Fatalf("Expected the episode to be planned: %v", plan.Episodes)
+	}
+	if _, err := os.Stat(downloadDir); !os.IsNotExist(err) {
+		t.Errorf("Planning created the download directory: %v", err)
+	}
+	if len(episodes.Episodes) != 0 || outline.LastUpdate != "" {
+		t.Errorf("Planning recorded the download: %v %q", episodes.Episodes, outline.LastUpdate)
+	}
+
+	plan.Pretend()
+	if episodes.Get("podcast-item-1") == nil || outline.LastUpdate != rssModel.Channel.Items[0].PubDate {
+		t.Errorf("Pretend did not record the planned episode: %v %q", episodes.Episodes, outline.LastUpdate)
+	}
+	if _, err := os.Stat(downloadDir); !os.IsNotExist(err) {
+		t.Errorf("Pretend created the download directory: %v", err)
+	}
+}
+
+func Test_IsPartialDownload(t *testing.T) {
+	for file, expected := range map[string]bool{
+		"episode.mp3":           false,
+		"episode.mp3.part":      true,
+		"episode.mp3.part.etag": true,
+		"episode.etag":          false,
+	} {
+		if actual := IsPartialDownload(file); actual != expected {
+			t.Errorf("IsPartialDownload(%q): \n%v\n%v", file, expected, actual)
+		}
+	}
+}
+
+func Test_DownloadErrorKinds(t *testing.T) {
+	textServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "this is neither a feed nor a podcast")
+	}))
+	defer textServer.Close()
+	closedServer := httptest.NewServer(http.NotFoundHandler())
+	closedServer.Close()
+
+	rssModel := Rss{Channel{Title: "Test Podcast", Items: []Item{{Title: "Podcast Item 1", Enclosure: Enclosure{Url: textServer.URL + "/episode"}}}}}
+	feedServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, rssModel.String())
+	}))
+	defer feedServer.Close()
+
+	tests := []struct {
+		xmlUrl  string
+		kind    ErrorKind
+		episode string
+	}{
+		{closedServer.URL, FETCH_ERROR, ""},
+		{textServer.URL, PARSE_ERROR, ""},
+		{feedServer.URL, MEDIA_ERROR, "Podcast Item 1"},
+	}
+
+	client, err := NewClient(opml.OpmlHead{RetryDelay: "1ms"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range tests {
+		outline := &opml.OpmlOutline{XmlUrl: test.xmlUrl}
+		_, err := Download(opml.OpmlHead{DownloadDir: os.TempDir()}, outline, &history.Subscription{}, client)
+		downloadError, ok := err.(*Error)
+		if errs, isErrors := err.(Errors); isErrors && len(errs) == 1 {
+			downloadError, ok = errs[0], true
+		}
+		if !ok {
+			t.Errorf("Expected a *Error for %s: %v", test.xmlUrl, err)
+			continue
+		}
+		if downloadError.Kind != test.kind || downloadError.XmlUrl != test.xmlUrl || downloadError.Episode != test.episode {
+			t.Errorf("Wrong error for %s: \n%q %q\n%q %q", test.xmlUrl, test.kind, test.episode, downloadError.Kind, downloadError.Episode)
+		}
+	}
+}
+
+func Test_PlanDownloadRejectsInvalidNaming(t *testing.T) {
+	tests := []struct {
+		head    opml.OpmlHead
+		outline opml.OpmlOutline
+	}{
+		{opml.OpmlHead{NamingTemplate: "/podcasts/{title}.{ext}"}, opml.OpmlOutline{}},
+		{opml.OpmlHead{}, opml.OpmlOutline{NamingTemplate: "{channel}/{unknown}.{ext}"}},
+		{opml.OpmlHead{FilenameMode: "ntfs"}, opml.OpmlOutline{}},
+	}
+
+	for _, test := range tests {
+		// the feed is never fetched
+		test.outline.XmlUrl = "http://127.0.0.1:1/feed.xml"
+		_, err := PlanDownload(test.head, &test.outline, &history.Subscription{}, nil)
+		if configError, ok := err.(*Error); !ok || configError.Kind != CONFIG_ERROR {
+			t.Errorf("Expected a config error for %+v %+v: %v", test.head, test.outline, err)
+		}
+	}
+}
+
+func Test_DownloadDetectsMediaTypeFromContent(t *testing.T) {
+	requests := 0
+	contentServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "application/octet-stream")
+		if r.URL.Path == "/text" {
+			fmt.Fprintln(w, "this is not a podcast")
+		} else {
+			fmt.Fprint(w, "fLaC\x00\x00\x00\x22 and the rest of the episode")
+		}
+	}))
+	defer contentServer.Close()
+
+	rssModel := Rss{Channel{Title: "Test Podcast", Items: []Item{
+		{Title: "Text", Guid: "text", PubDate: "Wed, 13 Aug 2014 21:20:36 +0000", Enclosure: Enclosure{Url: contentServer.URL + "/text"}},
+		{Title: "Flac", Guid: "flac", PubDate: "Tue, 12 Aug 2014 21:20:36 +0000", Enclosure: Enclosure{Url: contentServer.URL + "/episode"}},
+		{Title: "Podcast Item 1", Guid: "item-1", PubDate: "Mon, 11 Aug 2014 21:20:36 +0000", Enclosure: Enclosure{Url: "%s", Type: "audio/mpeg"}}}}}
+	mp3Server, rssServer := servers(rssModel.String())
+	defer mp3Server.Close()
+	defer rssServer.Close()
+
+	downloadDir, err := ioutil.TempDir("", "podcasts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(downloadDir)
+
+	outline := &opml.OpmlOutline{XmlUrl: rssServer.URL, Keep: 3}
+	episodes := &history.Subscription{}
+	plan, err := PlanDownload(opml.OpmlHead{DownloadDir: downloadDir}, outline, episodes, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Episodes) != 3 || len(plan.Errors) != 0 {
+		t.Fatalf("Episodes of unknown media type should be planned: %v %v", plan.Episodes, plan.Errors)
+	}
+	if requests != 0 {
+		t.Errorf("Planning requested the media of %d episodes", requests)
+	}
+
+	downloaded, err := plan.Execute()
+	if downloaded != 2 {
+		t.Errorf("Expected the flac and mp3 episodes to be downloaded: %d", downloaded)
+	}
+	if errs, ok := err.(Errors); !ok || len(errs) != 1 || errs[0].Kind != MEDIA_ERROR || errs[0].Episode != "Text" {
+		t.Errorf("Expected a media error for the text episode: %v", err)
+	}
+
+	expected := filepath.Join(downloadDir, "audio", "Test Podcast", "Flac.flac")
+	if episode := episodes.Get("flac"); episode == nil || episode.File != expected {
+		t.Errorf("Wrong file of the sniffed episode: \n%q\n%v", expected, episode)
+	}
+	if _, err := os.Stat(expected); err != nil {
+		t.Errorf("The sniffed episode was not downloaded: %v", err)
+	}
+	if outline.LastUpdate != "" {
+		t.Errorf("The feed should be retried after an episode failed: %q", outline.LastUpdate)
+	}
+}
+
+func Test_DownloadEpisodeRejectsBadResponses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/missing":
+			http.NotFound(w, r)
+		case "/html":
+			fmt.Fprint(w, "<!DOCTYPE html><html><body>Please log in</body></html>")
+		default:
+			http.ServeContent(w, r, "", time.Time{}, strings.NewReader(fakePodcast))
+		}
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "podcasts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		path            string
+		enclosureLength int64
+	}{
+		{"/missing", 0},
+		{"/html", 0},
+		{"/episode", MIN_ENCLOSURE_LENGTH * 2},
+	}
+
+	for _, test := range tests {
+		podcastFile := filepath.Join(dir, "episode.mp3")
+		if _, _, err := downloadEpisode(nil, server.URL+test.path, podcastFile, test.enclosureLength, nil); err == nil {
+			t.Errorf("Expected the download of %s to fail", test.path)
+		}
+		for _, file := range []string{podcastFile, podcastFile + partExt, podcastFile + partExt + etagExt} {
+			if _, err := os.Stat(file); !os.IsNotExist(err) {
+				t.Errorf("%s was not cleaned up after downloading %s: %v", file, test.path, err)
+			}
+		}
+	}
+}
+
+func Test_MatchesEnclosureLength(t *testing.T) {
+	tests := []struct {
+		size, enclosureLength int64
+		expected              bool
+	}{
+		{100, 0, true},
+		{100, 1, true},
+		{10000000, 10000000, true},
+		{11000000, 10000000, true},
+		{8000000, 10000000, true},
+		{7000000, 10000000, false},
+		{13000000, 10000000, false},
+		{0, 10000000, false},
+	}
+
+	for _, test := range tests {
+		if actual := matchesEnclosureLength(test.size, test.enclosureLength); actual != test.expected {
+			t.Errorf("matchesEnclosureLength(%d, %d): \n%v\n%v", test.size, test.enclosureLength, test.expected, actual)
+		}
+	}
+}
+
+func Test_FetchRssRejectsErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, Rss{Channel{Title: "Not Found"}}.String())
+	}))
+	defer server.Close()
+
+	_, err := fetchRss(nil, server.URL, "", "")
+	if fetchError, ok := err.(*Error); !ok || fetchError.Kind != FETCH_ERROR {
+		t.Errorf("Expected a fetch error for a 404 response: %v", err)
+	}
+}
@@ -0,0 +1,213 @@
+package rss
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"math"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	partExt = ".part"
+	etagExt = ".etag"
+)
+
+const (
+	// ENCLOSURE_LENGTH_TOLERANCE is the fraction by which the size of a download may differ
+	// from the length of its enclosure, feeds with dynamically inserted ads are rarely exact.
+	ENCLOSURE_LENGTH_TOLERANCE = 0.25
+	MIN_ENCLOSURE_LENGTH       = 64 * 1024
+)
+
+// IsPartialDownload reports whether file is one of the files an interrupted download leaves
+// behind to be resumed later.
+func IsPartialDownload(file string) bool {
+	return strings.HasSuffix(file, partExt) || strings.HasSuffix(file, partExt+etagExt)
+}
+
+// resumeValidator returns the ETag recorded for a partially downloaded file or "" if the
+// partial file cannot be resumed.
+func resumeValidator(partFile string) (etag string, offset int64) {
+	fi, err := os.Stat(partFile)
+	if err != nil || fi.Size() == 0 {
+		return "", 0
+	}
+
+	etagBytes, err := ioutil.ReadFile(partFile + etagExt)
+	if err != nil {
+		return "", 0
+	}
+
+	etag = strings.TrimSpace(string(etagBytes))
+	// weak validators are not allowed in an If-Range header
+	if etag == "" || strings.HasPrefix(etag, "W/") {
+		return "", 0
+	}
+
+	return etag, fi.Size()
+}
+
+// downloadEpisode downloads url into podcastFile.  The data is written to a .part file
+// next to podcastFile which is only renamed to podcastFile once the download is complete.
+// If a previous download was interrupted and the server sent an ETag the download is
+// resumed with a Range request.
+//
+// Error responses, HTML pages and downloads whose size does not match the Content-Length
+// of the response or, within ENCLOSURE_LENGTH_TOLERANCE, the length of the enclosure are
+// rejected and their .part file is removed.  enclosureLength is 0 if the feed does not
+// declare it.
+//
+// If the media type of the episode was unknown when podcastFile was named, resolve names
+// the file for the media type of the downloaded data and the downloaded episode is moved
+// there instead.  file is the path the episode was downloaded to.
+func downloadEpisode(client *Client, url, podcastFile string, enclosureLength int64, resolve func(mediaType) (string, error)) (file string, written int64, err error) {
+	partFile := podcastFile + partExt
+	etag, offset := resumeValidator(partFile)
+
+	request, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return "", 0, err
+	}
+	if offset > 0 {
+		log.Printf("Resuming download of %s at byte %d\n", podcastFile, offset)
+		request.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		request.Header.Set("If-Range", etag)
+	}
+
+	resp, err := client.do(request, nil)
+	if err != nil {
+		return "", 0, err
+	}
+	defer resp.Body.Close()
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	switch {
+	case offset > 0 && resp.StatusCode == http.StatusPartialContent:
+		if !strings.HasPrefix(resp.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", offset)) {
+			return "", 0, fmt.Errorf("Server returned unexpected range %q for %s", resp.Header.Get("Content-Range"), url)
+		}
+		flags = os.O_WRONLY | os.O_APPEND
+	case offset > 0 && resp.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+		removePartFile(partFile)
+		return "", 0, fmt.Errorf("Server rejected resuming the download of %s, it will be restarted on the next run", url)
+	case resp.StatusCode != http.StatusOK:
+		return "", 0, fmt.Errorf("Server returned %q for %s", resp.Status, url)
+	default:
+		offset = 0
+	}
+
+	body := bufio.NewReader(resp.Body)
+	if isHtml(resp.Header.Get("Content-Type"), body) {
+		return "", 0, fmt.Errorf("Server returned an HTML page instead of the podcast for %s", url)
+	}
+
+	dest, err := os.OpenFile(partFile, flags, 0644)
+	if err != nil {
+		return "", 0, diskError{fmt.Errorf("Unable to create file for podcast %s: %v", partFile, err)}
+	}
+	defer dest.Close()
+
+	if resp.StatusCode != http.StatusPartialContent || resp.Header.Get("ETag") != "" {
+		etag = resp.Header.Get("ETag")
+	}
+	os.Remove(partFile + etagExt)
+	if etag != "" {
+		if err := ioutil.WriteFile(partFile+etagExt, []byte(etag), 0644); err != nil {
+			log.Printf("Unable to record ETag of %s, an interrupted download will not be resumed: %v\n", partFile, err)
+		}
+	}
+
+	written, err = body.WriteTo(dest)
+	if err != nil {
+		return "", offset + written, fmt.Errorf("Failed to copy %v to %v due to %v", url, partFile, err)
+	}
+
+	if err := dest.Close(); err != nil {
+		return "", offset + written, diskError{fmt.Errorf("Failed to write %v: %v", partFile, err)}
+	}
+
+	if resp.ContentLength >= 0 && written != resp.ContentLength {
+		removePartFile(partFile)
+		return "", offset + written, fmt.Errorf("Downloaded %d bytes of %s but the server announced %d", written, url, resp.ContentLength)
+	}
+	if !matchesEnclosureLength(offset+written, enclosureLength) {
+		removePartFile(partFile)
+		return "", offset + written, fmt.Errorf("Downloaded %d bytes of %s but the feed announced %d", offset+written, url, enclosureLength)
+	}
+
+	if resolve != nil {
+		if podcastFile, err = resolveFile(resp.Header.Get("Content-Type"), partFile, resolve); err != nil {
+			removePartFile(partFile)
+			return "", offset + written, err
+		}
+	}
+
+	if err := os.Rename(partFile, podcastFile); err != nil {
+		return "", offset + written, diskError{fmt.Errorf("Failed to move %v to %v: %v", partFile, podcastFile, err)}
+	}
+	os.Remove(partFile + etagExt)
+
+	return podcastFile, offset + written, nil
+}
+
+// resolveFile names the file of a downloaded episode whose media type was unknown with
+// resolve.  The media type is the Content-Type of the response or, if it is not known, the
+// type of the first bytes of the downloaded data.
+func resolveFile(contentType, partFile string, resolve func(mediaType) (string, error)) (string, error) {
+	data, err := os.Open(partFile)
+	if err != nil {
+		return "", diskError{err}
+	}
+	start := make([]byte, 512)
+	n, _ := io.ReadFull(data, start)
+	data.Close()
+
+	media, err := contentMediaType(contentType, start[:n])
+	if err != nil {
+		return "", err
+	}
+
+	podcastFile, err := resolve(media)
+	if err != nil {
+		return "", diskError{err}
+	}
+	if err := os.MkdirAll(filepath.Dir(podcastFile), 0755); err != nil {
+		return "", diskError{fmt.Errorf("Failed to make podcast directory %q: %v", filepath.Dir(podcastFile), err)}
+	}
+	return podcastFile, nil
+}
+
+func removePartFile(partFile string) {
+	os.Remove(partFile)
+	os.Remove(partFile + etagExt)
+}
+
+// isHtml reports whether a response is an HTML page, such as the error or login page of a
+// server that does not use the status code, by its Content-Type or its first bytes.
+func isHtml(contentType string, body *bufio.Reader) bool {
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil && (mediaType == "text/html" || mediaType == "application/xhtml+xml") {
+		return true
+	}
+
+	start, _ := body.Peek(512)
+	return strings.HasPrefix(http.DetectContentType(start), "text/html")
+}
+
+// matchesEnclosureLength reports whether size is within ENCLOSURE_LENGTH_TOLERANCE of the
+// length of the enclosure.  Lengths below MIN_ENCLOSURE_LENGTH are placeholders that many
+// feeds use when they do not know the size, they are not checked.
+func matchesEnclosureLength(size, enclosureLength int64) bool {
+	if enclosureLength < MIN_ENCLOSURE_LENGTH {
+		return true
+	}
+
+	difference := math.Abs(float64(size - enclosureLength))
+	return difference <= ENCLOSURE_LENGTH_TOLERANCE*float64(enclosureLength)
+}
@@ -0,0 +1,64 @@
+package rss
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrorKind tells which step of downloading a feed failed.
+type ErrorKind string
+
+const (
+	FETCH_ERROR ErrorKind = "fetch"
+	PARSE_ERROR ErrorKind = "parse"
+	MEDIA_ERROR ErrorKind = "media"
+	DISK_ERROR  ErrorKind = "disk"
+	// CONFIG_ERROR is an invalid setting of the head or of the outline of the feed
+	CONFIG_ERROR ErrorKind = "config"
+)
+
+// Error is an error downloading the feed at XmlUrl or one of its episodes.  Episode and
+// Url are the title and the media url of the episode, they are empty for errors of the feed.
+type Error struct {
+	Kind    ErrorKind
+	XmlUrl  string
+	Episode string
+	Url     string
+	Err     error
+}
+
+func (err *Error) Error() string {
+	if err.Episode != "" || err.Url != "" {
+		return fmt.Sprintf("%s error for episode %q of %s: %v", err.Kind, err.Episode, err.XmlUrl, err.Err)
+	}
+	return fmt.Sprintf("%s error for %s: %v", err.Kind, err.XmlUrl, err.Err)
+}
+
+func (err *Error) Unwrap() error {
+	return err.Err
+}
+
+// Errors are the errors of the episodes of a feed that could not be downloaded.
+type Errors []*Error
+
+func (errs Errors) Error() string {
+	if len(errs) == 1 {
+		return errs[0].Error()
+	}
+	return fmt.Sprintf("%v (and %d more errors)", errs[0], len(errs)-1)
+}
+
+// diskError marks the errors of downloadEpisode that are caused by writing the file rather
+// than by downloading it.
+type diskError struct {
+	error
+}
+
+// downloadErrorKind is DISK_ERROR for a diskError and MEDIA_ERROR otherwise.
+func downloadErrorKind(err error) ErrorKind {
+	var disk diskError
+	if errors.As(err, &disk) {
+		return DISK_ERROR
+	}
+	return MEDIA_ERROR
+}
@@ -0,0 +1,131 @@
+package rss
+
+import (
+	"bytes"
+	"fmt"
+	"gopod/charset"
+	"gopod/history"
+	"gopod/opml"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+)
+
+type feedResponse struct {
+	rss    *Rss
+	header http.Header
+	// warnings are the problems the lenient parser recovered from if the feed is not
+	// well-formed
+	warnings []string
+	// notModified is true if the server responded to a conditional request with 304 Not
+	// Modified, in which case rss is nil.
+	notModified bool
+	// movedTo is the url the feed was permanently redirected to or "" if there was no
+	// permanent redirect.
+	movedTo string
+}
+
+// FetchRss downloads and parses the Rss or Atom feed at url.
+func FetchRss(client *Client, url string) (*Rss, error) {
+	feed, err := fetchRss(client, url, "", "")
+	if err != nil {
+		return nil, err
+	}
+	for _, warning := range feed.warnings {
+		log.Printf("Warning for %s: %s\n", url, warning)
+	}
+	return feed.rss, nil
+}
+
+// fetchRss downloads and parses the feed at url.  If etag or lastModified are not empty
+// the request is made conditional.  Errors are a *Error of kind FETCH_ERROR or PARSE_ERROR.
+func fetchRss(client *Client, url, etag, lastModified string) (*feedResponse, error) {
+	log.Printf("Downloading Rss feed from %q\n", url)
+	request, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, &Error{Kind: FETCH_ERROR, XmlUrl: url, Err: err}
+	}
+	if etag != "" {
+		request.Header.Set("If-None-Match", etag)
+	}
+	if lastModified != "" {
+		request.Header.Set("If-Modified-Since", lastModified)
+	}
+
+	feed := &feedResponse{}
+	permanent := true
+	checkRedirect := func(redirect *http.Request, via []*http.Request) error {
+		if len(via) >= 10 {
+			return http.ErrUseLastResponse
+		}
+		// only a chain of permanent redirects moves the subscription
+		status := redirect.Response.StatusCode
+		permanent = permanent && (status == http.StatusMovedPermanently || status == http.StatusPermanentRedirect)
+		if permanent {
+			feed.movedTo = redirect.URL.String()
+		}
+		return nil
+	}
+
+	resp, err := client.do(request, checkRedirect)
+	if err != nil {
+		return nil, &Error{Kind: FETCH_ERROR, XmlUrl: url, Err: err}
+	}
+
+	value := resp.Body
+	defer value.Close()
+
+	feed.header = resp.Header
+	if resp.StatusCode == http.StatusNotModified {
+		feed.notModified = true
+		return feed, nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, &Error{Kind: FETCH_ERROR, XmlUrl: url, Err: fmt.Errorf("Server returned %q", resp.Status)}
+	}
+
+	rssFeedText, err := ioutil.ReadAll(value)
+	if err != nil {
+		return nil, &Error{Kind: FETCH_ERROR, XmlUrl: url, Err: err}
+	}
+
+	// the charset of the Content-Type takes precedence over the XML declaration
+	if rssFeedText, err = charset.ToUtf8(rssFeedText, resp.Header.Get("Content-Type")); err != nil {
+		return nil, &Error{Kind: PARSE_ERROR, XmlUrl: url, Err: err}
+	}
+
+	if feed.rss, feed.warnings, err = ParseFeedLenient(bytes.NewReader(rssFeedText)); err != nil {
+		return nil, &Error{Kind: PARSE_ERROR, XmlUrl: url, Err: err}
+	}
+	return feed, nil
+}
+
+func isFeedUrl(rawUrl string) bool {
+	parsed, err := url.Parse(rawUrl)
+	return err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != ""
+}
+
+// Move changes the url of the outline of the plan and of its history to the url the feed
+// moved to, if it moved.  The subscription is not moved if another outline or another
+// history already uses the new url, the two subscriptions have to be merged by hand.  Move
+// is called once the feeds of all outlines have been fetched.
+func (plan *Plan) Move(configModel *opml.Opml, historyModel *history.History) bool {
+	if plan.movedTo == "" || plan.movedTo == plan.outline.XmlUrl {
+		return false
+	}
+
+	inUse := configModel.Body.GetByXmlUrl(plan.movedTo) != nil
+	for _, subscription := range historyModel.Subscriptions {
+		inUse = inUse || (subscription != plan.history && subscription.XmlUrl == plan.movedTo)
+	}
+	if inUse {
+		log.Printf("Podcast %q moved from %q to %q because %s, but %q is already subscribed, keeping the old url\n", plan.outline.Title, plan.outline.XmlUrl, plan.movedTo, plan.moveReason, plan.movedTo)
+		return false
+	}
+
+	log.Printf("Podcast %q moved from %q to %q because %s\n", plan.outline.Title, plan.outline.XmlUrl, plan.movedTo, plan.moveReason)
+	plan.outline.XmlUrl = plan.movedTo
+	plan.history.XmlUrl = plan.movedTo
+	return true
+}
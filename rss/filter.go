@@ -0,0 +1,143 @@
+package rss
+
+import (
+	"fmt"
+	"gopod/opml"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Skipped is an episode of the feed that the filter of the outline excluded.
+type Skipped struct {
+	Title  string
+	Reason string
+}
+
+// filter is the compiled form of an opml.OpmlFilter, the zero value matches every item.
+type filter struct {
+	includeTitle, excludeTitle             *regexp.Regexp
+	includeDescription, excludeDescription *regexp.Regexp
+	categories, excludeCategories          []string
+	episodeTypes                           []string
+	minDuration, maxDuration               time.Duration
+	explicit                               string
+}
+
+// newFilter compiles the filter of an outline, config may be nil.
+func newFilter(config *opml.OpmlFilter) (*filter, error) {
+	f := &filter{}
+	if config == nil {
+		return f, nil
+	}
+
+	var err error
+	for _, expression := range []struct {
+		name, value string
+		compiled    **regexp.Regexp
+	}{
+		{"includeTitle", config.IncludeTitle, &f.includeTitle},
+		{"excludeTitle", config.ExcludeTitle, &f.excludeTitle},
+		{"includeDescription", config.IncludeDescription, &f.includeDescription},
+		{"excludeDescription", config.ExcludeDescription, &f.excludeDescription},
+	} {
+		if expression.value == "" {
+			continue
+		}
+		if *expression.compiled, err = regexp.Compile(expression.value); err != nil {
+			return nil, fmt.Errorf("Invalid %s filter %q: %v", expression.name, expression.value, err)
+		}
+	}
+
+	f.categories = filterList(config.Category)
+	f.excludeCategories = filterList(config.ExcludeCategory)
+	f.episodeTypes = filterList(config.EpisodeType)
+
+	if config.MinDuration != "" {
+		if f.minDuration, err = time.ParseDuration(config.MinDuration); err != nil {
+			return nil, fmt.Errorf("Invalid minDuration filter %q: %v", config.MinDuration, err)
+		}
+	}
+	if config.MaxDuration != "" {
+		if f.maxDuration, err = time.ParseDuration(config.MaxDuration); err != nil {
+			return nil, fmt.Errorf("Invalid maxDuration filter %q: %v", config.MaxDuration, err)
+		}
+	}
+
+	switch f.explicit = strings.ToLower(strings.TrimSpace(config.Explicit)); f.explicit {
+	case "", "yes", "no":
+	default:
+		return nil, fmt.Errorf("Invalid explicit filter %q, it must be \"yes\" or \"no\"", config.Explicit)
+	}
+
+	return f, nil
+}
+
+func filterList(list string) []string {
+	values := []string{}
+	for _, value := range strings.Split(list, ",") {
+		if value = strings.ToLower(strings.TrimSpace(value)); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func containsValue(values []string, value string) bool {
+	value = strings.ToLower(strings.TrimSpace(value))
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// containsAny reports whether one of candidates is in values.
+func containsAny(values, candidates []string) bool {
+	for _, candidate := range candidates {
+		if containsValue(values, candidate) {
+			return true
+		}
+	}
+	return false
+}
+
+// exclude returns why the filter excludes item or "" if the item is downloaded.  Items
+// without an episodeType are full episodes.
+func (f *filter) exclude(item Item) string {
+	description := item.Description
+	if description == "" {
+		description = item.Summary
+	}
+	episodeType := item.EpisodeType
+	if episodeType == "" {
+		episodeType = "full"
+	}
+
+	switch {
+	case f.includeTitle != nil && !f.includeTitle.MatchString(item.Title):
+		return fmt.Sprintf("title does not match %q", f.includeTitle)
+	case f.excludeTitle != nil && f.excludeTitle.MatchString(item.Title):
+		return fmt.Sprintf("title matches %q", f.excludeTitle)
+	case f.includeDescription != nil && !f.includeDescription.MatchString(description):
+		return fmt.Sprintf("description does not match %q", f.includeDescription)
+	case f.excludeDescription != nil && f.excludeDescription.MatchString(description):
+		return fmt.Sprintf("description matches %q", f.excludeDescription)
+	case len(f.categories) > 0 && !containsAny(f.categories, item.Categories):
+		return fmt.Sprintf("categories %q are not one of %s", item.Categories, strings.Join(f.categories, ", "))
+	case containsAny(f.excludeCategories, item.Categories):
+		return fmt.Sprintf("categories %q include an excluded one", item.Categories)
+	case len(f.episodeTypes) > 0 && !containsValue(f.episodeTypes, episodeType):
+		return fmt.Sprintf("episode type %q is not one of %s", episodeType, strings.Join(f.episodeTypes, ", "))
+	case f.minDuration > 0 && item.Duration > 0 && item.Duration < f.minDuration:
+		return fmt.Sprintf("duration %v is shorter than %v", item.Duration, f.minDuration)
+	case f.maxDuration > 0 && item.Duration > f.maxDuration:
+		return fmt.Sprintf("duration %v is longer than %v", item.Duration, f.maxDuration)
+	case f.explicit == "yes" && !item.Explicit:
+		return "episode is not explicit"
+	case f.explicit == "no" && item.Explicit:
+		return "episode is explicit"
+	}
+	return ""
+}
@@ -0,0 +1,114 @@
+package rss
+
+import (
+	"gopod/opml"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFilterExclude(t *testing.T) {
+	episode := Item{Title: "Episode 12", Description: "The full show", Categories: []string{"News"}, Duration: 45 * time.Minute}
+	trailer := Item{Title: "Season 2 Trailer", Description: "Coming soon", Categories: []string{"News"}, EpisodeType: "trailer", Duration: 2 * time.Minute}
+	tagged := Item{Title: "Season 3 Preview", Categories: []string{"Trailer", "News"}}
+	rerun := Item{Title: "Episode 3 (Rerun)", Description: "From the archive", Categories: []string{"Best Of"}, Explicit: true}
+
+	tests := []struct {
+		config   opml.OpmlFilter
+		item     Item
+		excluded bool
+	}{
+		{opml.OpmlFilter{}, trailer, false},
+		{opml.OpmlFilter{ExcludeTitle: "(?i)trailer|rerun"}, trailer, true},
+		{opml.OpmlFilter{ExcludeTitle: "(?i)trailer|rerun"}, rerun, true},
+		{opml.OpmlFilter{ExcludeTitle: "(?i)trailer|rerun"}, episode, false},
+		{opml.OpmlFilter{IncludeTitle: `^Episode \d+$`}, episode, false},
+		{opml.OpmlFilter{IncludeTitle: `^Episode \d+$`}, rerun, true},
+		{opml.OpmlFilter{IncludeDescription: "full"}, trailer, true},
+		{opml.OpmlFilter{ExcludeDescription: "archive"}, rerun, true},
+		{opml.OpmlFilter{Category: "news, politics"}, episode, false},
+		{opml.OpmlFilter{Category: "news, politics"}, rerun, true},
+		{opml.OpmlFilter{ExcludeCategory: "best of"}, rerun, true},
+		{opml.OpmlFilter{ExcludeCategory: "trailer"}, tagged, true},
+		{opml.OpmlFilter{Category: "news"}, tagged, false},
+		{opml.OpmlFilter{Category: "politics"}, tagged, true},
+		{opml.OpmlFilter{EpisodeType: "full"}, episode, false},
+		{opml.OpmlFilter{EpisodeType: "full,bonus"}, trailer, true},
+		{opml.OpmlFilter{MinDuration: "10m"}, trailer, true},
+		{opml.OpmlFilter{MinDuration: "10m"}, rerun, false},
+		{opml.OpmlFilter{MaxDuration: "30m"}, episode, true},
+		{opml.OpmlFilter{Explicit: "no"}, rerun, true},
+		{opml.OpmlFilter{Explicit: "yes"}, episode, true},
+	}
+
+	for _, test := range tests {
+		f, err := newFilter(&test.config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reason := f.exclude(test.item); (reason != "") != test.excluded {
+			t.Errorf("Wrong result of filter %+v for %q: \n%v\n%q", test.config, test.item.Title, test.excluded, reason)
+		}
+	}
+}
+
+func TestNewFilterRejectsInvalidSettings(t *testing.T) {
+	for _, config := range []opml.OpmlFilter{
+		{IncludeTitle: "("},
+		{ExcludeDescription: "[a-"},
+		{MinDuration: "ten minutes"},
+		{MaxDuration: "1x"},
+		{Explicit: "maybe"},
+	} {
+		if _, err := newFilter(&config); err == nil {
+			t.Errorf("Expected an error for filter %+v", config)
+		}
+	}
+}
+
+func TestSelectEpisodesFilter(t *testing.T) {
+	items := []Item{
+		{Title: "trailer", PubDate: "Sat, 01 Mar 2014 10:00:00 +0000", EpisodeType: "trailer", Enclosure: Enclosure{Url: "http://example.com/trailer.mp3"}},
+		{Title: "feb", PubDate: "Sat, 01 Feb 2014 10:00:00 +0000", Enclosure: Enclosure{Url: "http://example.com/feb.mp3"}},
+		{Title: "old trailer", PubDate: "Tue, 01 Jan 2013 10:00:00 +0000", EpisodeType: "trailer", Enclosure: Enclosure{Url: "http://example.com/old.mp3"}},
+		{Title: "jan", PubDate: "Wed, 01 Jan 2014 10:00:00 +0000", Enclosure: Enclosure{Url: "http://example.com/jan.mp3"}},
+	}
+
+	f, err := newFilter(&opml.OpmlFilter{EpisodeType: "full"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	selected, skipped, _ := selectEpisodes(items, 2, f)
+	if len(selected) != 2 || selected[0].Title != "feb" || selected[1].Title != "jan" {
+		t.Errorf("Wrong episodes selected: %v", selected)
+	}
+	if len(skipped) != 1 || skipped[0].Title != "trailer" {
+		t.Errorf("Only the trailer newer than the selected episodes should be skipped: %v", skipped)
+	}
+}
+
+func TestFilterMatchesEveryCategory(t *testing.T) {
+	feeds := []string{
+		`<rss><channel><item><title>Preview</title><category>Trailer</category><category>News</category></item></channel></rss>`,
+		`<feed xmlns="http://www.w3.org/2005/Atom"><entry><title>Preview</title><category term="Trailer"/><category term="News"/></entry></feed>`,
+	}
+
+	f, err := newFilter(&opml.OpmlFilter{ExcludeCategory: "trailer"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, feed := range feeds {
+		parsed, err := ParseFeed(strings.NewReader(feed))
+		if err != nil {
+			t.Fatal(err)
+		}
+		item := parsed.Channel.Items[0]
+		if !reflect.DeepEqual(item.Categories, []string{"Trailer", "News"}) {
+			t.Errorf("Wrong categories: \n%q\n%q", []string{"Trailer", "News"}, item.Categories)
+		}
+		if f.exclude(item) == "" {
+			t.Errorf("An item with an excluded category was not excluded: %q", item.Categories)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package rss
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// item has the fields of Item without its methods so it can be decoded and encoded
+// without recursing into Item.UnmarshalXML and Item.MarshalXML.
+type item Item
+
+// itunesItem is the xml form of an Item, the itunes fields are kept as text.
+type itunesItem struct {
+	item
+	Duration    string       `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd duration,omitempty"`
+	Episode     string       `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd episode,omitempty"`
+	Season      string       `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd season,omitempty"`
+	EpisodeType string       `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd episodeType,omitempty"`
+	Explicit    string       `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd explicit,omitempty"`
+	Image       *itunesImage `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd image,omitempty"`
+	Summary     string       `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd summary,omitempty"`
+}
+
+type itunesImage struct {
+	Href string `xml:"href,attr"`
+}
+
+// parseDuration parses an itunes:duration which is either a number of seconds or
+// [HH:]MM:SS.
+func parseDuration(duration string) (time.Duration, error) {
+	parts := strings.Split(strings.TrimSpace(duration), ":")
+	if len(parts) > 3 {
+		return 0, fmt.Errorf("Invalid duration %q", duration)
+	}
+
+	var total float64
+	for _, part := range parts {
+		value, err := strconv.ParseFloat(part, 64)
+		if err != nil || value < 0 {
+			return 0, fmt.Errorf("Invalid duration %q", duration)
+		}
+		total = total*60 + value
+	}
+
+	return time.Duration(total * float64(time.Second)), nil
+}
+
+func formatDuration(duration time.Duration) string {
+	seconds := int64(duration / time.Second)
+	return fmt.Sprintf("%02d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+}
+
+func parseExplicit(explicit string) bool {
+	switch strings.ToLower(strings.TrimSpace(explicit)) {
+	case "yes", "true", "explicit":
+		return true
+	}
+	return false
+}
+
+// UnmarshalXML decodes an item.  Itunes values that cannot be parsed are ignored rather
+// than failing the whole feed.
+func (i *Item) UnmarshalXML(decoder *xml.Decoder, start xml.StartElement) error {
+	var raw itunesItem
+	if err := decoder.DecodeElement(&raw, &start); err != nil {
+		return err
+	}
+
+	*i = Item(raw.item)
+	i.Duration, _ = parseDuration(raw.Duration)
+	i.Episode, _ = strconv.Atoi(strings.TrimSpace(raw.Episode))
+	i.Season, _ = strconv.Atoi(strings.TrimSpace(raw.Season))
+	i.EpisodeType = strings.ToLower(strings.TrimSpace(raw.EpisodeType))
+	i.Explicit = parseExplicit(raw.Explicit)
+	i.Summary = raw.Summary
+	if raw.Image != nil {
+		i.Image = raw.Image.Href
+	}
+
+	return nil
+}
+
+func (i Item) MarshalXML(encoder *xml.Encoder, start xml.StartElement) error {
+	raw := itunesItem{
+		item:        item(i),
+		EpisodeType: i.EpisodeType,
+		Summary:     i.Summary}
+
+	if i.Duration > 0 {
+		raw.Duration = formatDuration(i.Duration)
+	}
+	if i.Episode > 0 {
+		raw.Episode = strconv.Itoa(i.Episode)
+	}
+	if i.Season > 0 {
+		raw.Season = strconv.Itoa(i.Season)
+	}
+	if i.Explicit {
+		raw.Explicit = "yes"
+	}
+	if i.Image != "" {
+		raw.Image = &itunesImage{i.Image}
+	}
+
+	return encoder.EncodeElement(raw, start)
+}
@@ -0,0 +1,124 @@
+package rss
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const itunesRss = `<?xml version="1.0" encoding="UTF-8"?>
+<rss xmlns:itunes="http://www.itunes.com/dtds/podcast-1.0.dtd" version="2.0">
+	<channel>
+		<title>Itunes Show</title>
+		<itunes:author>Jane Doe</itunes:author>
+		<itunes:new-feed-url>http://example.org/new-feed.xml</itunes:new-feed-url>
+		<itunes:category text="Technology">
+			<itunes:category text="Tech News" />
+		</itunes:category>
+		<itunes:category text="News" />
+		<item>
+			<title>Episode 12</title>
+			<guid>episode-12</guid>
+			<itunes:duration>1:02:03</itunes:duration>
+			<itunes:episode>12</itunes:episode>
+			<itunes:season>2</itunes:season>
+			<itunes:episodeType>Full</itunes:episodeType>
+			<itunes:explicit>yes</itunes:explicit>
+			<itunes:image href="http://example.org/episode-12.png" />
+			<itunes:summary>The twelfth episode.</itunes:summary>
+		</item>
+		<item>
+			<title>Trailer</title>
+			<itunes:duration>95</itunes:duration>
+			<itunes:episode>not a number</itunes:episode>
+			<itunes:episodeType>trailer</itunes:episodeType>
+			<itunes:explicit>clean</itunes:explicit>
+		</item>
+	</channel>
+</rss>`
+
+func TestParseItunes(t *testing.T) {
+	rss, err := ParseRss(strings.NewReader(itunesRss))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	channel := rss.Channel
+	if channel.Author != "Jane Doe" {
+		t.Errorf("Wrong channel author: %q", channel.Author)
+	}
+	if channel.NewFeedUrl != "http://example.org/new-feed.xml" {
+		t.Errorf("Wrong channel new-feed-url: %q", channel.NewFeedUrl)
+	}
+	if len(channel.ItunesCategories) != 2 || channel.ItunesCategories[0].Text != "Technology" || channel.ItunesCategories[1].Text != "News" {
+		t.Fatalf("Wrong channel categories: %v", channel.ItunesCategories)
+	}
+	if subcategories := channel.ItunesCategories[0].Subcategories; len(subcategories) != 1 || subcategories[0].Text != "Tech News" {
+		t.Errorf("Wrong channel subcategories: %v", subcategories)
+	}
+
+	if len(channel.Items) != 2 {
+		t.Fatalf("Expected 2 items but got %d", len(channel.Items))
+	}
+
+	checkItem(t, 0, channel.Items, Item{
+		Title:       "Episode 12",
+		Guid:        "episode-12",
+		Duration:    time.Hour + 2*time.Minute + 3*time.Second,
+		Episode:     12,
+		Season:      2,
+		EpisodeType: "full",
+		Explicit:    true,
+		Image:       "http://example.org/episode-12.png",
+		Summary:     "The twelfth episode."})
+
+	checkItem(t, 1, channel.Items, Item{
+		Title:       "Trailer",
+		Duration:    95 * time.Second,
+		EpisodeType: "trailer"})
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		duration string
+		expected time.Duration
+		valid    bool
+	}{
+		{"3723", 3723 * time.Second, true},
+		{"62:03", 62*time.Minute + 3*time.Second, true},
+		{"01:02:03", time.Hour + 2*time.Minute + 3*time.Second, true},
+		{" 10.5 ", 10500 * time.Millisecond, true},
+		{"", 0, false},
+		{"1:2:3:4", 0, false},
+		{"one hour", 0, false},
+	}
+
+	for _, test := range tests {
+		duration, err := parseDuration(test.duration)
+		if (err == nil) != test.valid {
+			t.Errorf("parseDuration(%q) returned error %v", test.duration, err)
+		}
+		if duration != test.expected {
+			t.Errorf("parseDuration(%q) = %v but expected %v", test.duration, duration, test.expected)
+		}
+	}
+}
+
+func TestWriteReadItunesItem(t *testing.T) {
+	original := Rss{Channel{Title: "Itunes Show", Items: []Item{{
+		Title:       "Episode 12",
+		Duration:    time.Hour + 2*time.Minute + 3*time.Second,
+		Episode:     12,
+		Season:      2,
+		EpisodeType: "full",
+		Explicit:    true,
+		Image:       "http://example.org/episode-12.png",
+		Summary:     "The twelfth episode."}}}}
+
+	parsed, err := ParseRss(strings.NewReader(original.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkItem(t, 0, parsed.Channel.Items, original.Channel.Items[0])
+}
@@ -0,0 +1,209 @@
+package rss
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"gopod/charset"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	entityReference = regexp.MustCompile(`^&(#[0-9]+|#[xX][0-9a-fA-F]+|[A-Za-z][A-Za-z0-9]*);`)
+	feedRoot        = regexp.MustCompile(`<(rss|RSS|Rss|feed)[\s>][^>]*>`)
+	xmlEntities     = map[string]bool{"amp": true, "lt": true, "gt": true, "quot": true, "apos": true}
+)
+
+// sanitizeXml is the first pass of lenient parsing.  It replaces invalid UTF-8 with
+// U+FFFD, removes the control characters XML does not allow and escapes the ampersands
+// that do not start an entity reference.  The warnings describe what was changed.
+func sanitizeXml(data []byte) ([]byte, []string) {
+	sanitized := make([]byte, 0, len(data))
+	invalidBytes, controls, ampersands, htmlEntities := 0, 0, 0, 0
+
+	for i := 0; i < len(data); {
+		r, size := utf8.DecodeRune(data[i:])
+		switch {
+		case r == utf8.RuneError && size <= 1:
+			sanitized = append(sanitized, string(utf8.RuneError)...)
+			invalidBytes++
+		case r < 0x20 && r != '\t' && r != '\n' && r != '\r':
+			controls++
+		case r == '&':
+			reference := entityReference.FindSubmatch(data[i:])
+			if reference == nil {
+				sanitized = append(sanitized, "&amp;"...)
+				ampersands++
+			} else {
+				name := string(reference[1])
+				if _, ok := xml.HTMLEntity[name]; ok && !xmlEntities[name] {
+					htmlEntities++
+				}
+				sanitized = append(sanitized, '&')
+			}
+		default:
+			sanitized = append(sanitized, data[i:i+size]...)
+		}
+		i += size
+	}
+
+	warnings := []string{}
+	if invalidBytes > 0 {
+		warnings = append(warnings, fmt.Sprintf("Replaced %d bytes that are not valid UTF-8", invalidBytes))
+	}
+	if controls > 0 {
+		warnings = append(warnings, fmt.Sprintf("Removed %d control characters", controls))
+	}
+	if ampersands > 0 {
+		warnings = append(warnings, fmt.Sprintf("Escaped %d ampersands that do not start an entity", ampersands))
+	}
+	if htmlEntities > 0 {
+		warnings = append(warnings, fmt.Sprintf("Decoded %d HTML entities such as &nbsp;", htmlEntities))
+	}
+	return sanitized, warnings
+}
+
+// decodeLenient decodes data with a decoder that accepts HTML entities, unclosed HTML
+// elements and malformed entity references.
+func decodeLenient(data []byte, v interface{}) error {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.Strict = false
+	decoder.AutoClose = xml.HTMLAutoClose
+	decoder.Entity = xml.HTMLEntity
+	return decoder.Decode(v)
+}
+
+// salvageElements decodes every element called name of the document separately into
+// elements, a pointer to a slice, so that a malformed element does not prevent decoding
+// the others.  The elements are wrapped in the root element of the document so they keep
+// its namespace declarations.  It returns the document without the elements and a
+// warning for every element that could not be decoded.
+func salvageElements(data []byte, name string, elements interface{}) ([]byte, []string) {
+	root := feedRoot.FindSubmatch(data)
+	if root == nil {
+		return data, nil
+	}
+
+	element := regexp.MustCompile(`(?s)<` + name + `[\s>].*?</` + name + `\s*>`)
+	warnings := []string{}
+	index := 0
+	rest := element.ReplaceAllFunc(data, func(match []byte) []byte {
+		index++
+		wrapped := append(append(append([]byte{}, root[0]...), match...), "</"+string(root[1])+">"...)
+		if err := decodeLenient(wrapped, elements); err != nil {
+			warnings = append(warnings, fmt.Sprintf("Skipped <%s> number %d that cannot be parsed: %v", name, index, err))
+		}
+		return nil
+	})
+
+	return rest, warnings
+}
+
+// itemsOf collects the items of wrapped <item> elements.
+type itemsOf struct {
+	Items []Item `xml:"item"`
+}
+
+type entriesOf struct {
+	Entries []atomEntry `xml:"entry"`
+}
+
+// ParseRssLenient parses an Rss 2.0 feed that may not be well-formed XML.  The document is
+// sanitized, HTML entities are accepted and every item that can be parsed is kept.  The
+// warnings describe the problems that were recovered from.
+func ParseRssLenient(reader io.Reader) (*Rss, []string, error) {
+	data, warnings, err := readLenient(reader)
+	if err != nil {
+		return nil, warnings, err
+	}
+
+	// decoding appends to the slice, so a failed item does not lose the earlier ones
+	var items itemsOf
+	rest, itemWarnings := salvageElements(data, "item", &items)
+	warnings = append(warnings, itemWarnings...)
+
+	var rss Rss
+	if err := decodeLenient(rest, &rss); err != nil {
+		if len(items.Items) == 0 {
+			return nil, warnings, err
+		}
+		warnings = append(warnings, fmt.Sprintf("The channel cannot be parsed: %v", err))
+	}
+	rss.Channel.Items = items.Items
+
+	return &rss, warnings, nil
+}
+
+// parseAtomLenient is ParseRssLenient for Atom feeds.
+func parseAtomLenient(reader io.Reader) (*Rss, []string, error) {
+	data, warnings, err := readLenient(reader)
+	if err != nil {
+		return nil, warnings, err
+	}
+
+	var entries entriesOf
+	rest, entryWarnings := salvageElements(data, "entry", &entries)
+	warnings = append(warnings, entryWarnings...)
+
+	var feed atomFeed
+	if err := decodeLenient(rest, &feed); err != nil {
+		if len(entries.Entries) == 0 {
+			return nil, warnings, err
+		}
+		warnings = append(warnings, fmt.Sprintf("The feed cannot be parsed: %v", err))
+	}
+	feed.Entries = entries.Entries
+
+	return feed.rss(), warnings, nil
+}
+
+func readLenient(reader io.Reader) ([]byte, []string, error) {
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	if data, err = charset.ToUtf8(data, ""); err != nil {
+		return nil, nil, err
+	}
+
+	data, warnings := sanitizeXml(data)
+	return data, warnings, nil
+}
+
+// ParseFeedLenient parses a feed like ParseFeed and falls back to the lenient parsers if
+// the feed is not well-formed.  The warnings are empty if the feed is well-formed.
+func ParseFeedLenient(reader io.Reader) (*Rss, []string, error) {
+	feedText, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	if feedText, err = charset.ToUtf8(feedText, ""); err != nil {
+		return nil, nil, err
+	}
+
+	rss, strictErr := ParseFeed(bytes.NewReader(feedText))
+	if strictErr == nil {
+		return rss, nil, nil
+	}
+
+	root := feedRoot.FindSubmatch(feedText)
+	if root == nil {
+		return nil, nil, strictErr
+	}
+
+	var warnings []string
+	if strings.ToLower(string(root[1])) == "feed" {
+		rss, warnings, err = parseAtomLenient(bytes.NewReader(feedText))
+	} else {
+		rss, warnings, err = ParseRssLenient(bytes.NewReader(feedText))
+	}
+	if err != nil {
+		return nil, warnings, strictErr
+	}
+
+	return rss, append([]string{fmt.Sprintf("The feed is not well-formed: %v", strictErr)}, warnings...), nil
+}
@@ -0,0 +1,103 @@
+package rss
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+const malformedRss = `<?xml version="1.0"?>
+<rss version="2.0" xmlns:itunes="http://www.itunes.com/dtds/podcast-1.0.dtd">
+<channel>
+<title>Tom &amp; Jerry&nbsp;Show</title>
+<item>
+	<title>Episode 1 &ndash; Caf` + "\xe9\x01" + `</title>
+	<enclosure url="http://example.com/1.mp3?a=1&b=2" type="audio/mpeg"/>
+	<itunes:duration>1:02:03</itunes:duration>
+</item>
+<item>
+	<title>Episode 2</title>
+	<description><![CDATA[ truncated description</description>
+	<enclosure url="http://example.com/2.mp3" type="audio/mpeg"/>
+</item>
+<item>
+	<title>Episode 3 & friends</title>
+	<enclosure url="http://example.com/3.mp3" type="audio/mpeg"/>
+</item>
+</channel>
+</rss>`
+
+func TestParseRssLenient(t *testing.T) {
+	if _, err := ParseFeed(strings.NewReader(malformedRss)); err == nil {
+		t.Fatal("Expected the strict parser to reject the feed")
+	}
+
+	rss, warnings, err := ParseFeedLenient(strings.NewReader(malformedRss))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rss.Channel.Title != "Tom & Jerry Show" {
+		t.Errorf("Wrong channel title: \n%q\n%q", "Tom & Jerry Show", rss.Channel.Title)
+	}
+
+	items := rss.Channel.Items
+	if len(items) != 2 {
+		t.Fatalf("Expected the 2 well-formed items to be salvaged: %v", items)
+	}
+	if items[0].Title != "Episode 1 – Caf�" {
+		t.Errorf("Wrong title of the first item: \n%q\n%q", "Episode 1 – Caf�", items[0].Title)
+	}
+	if items[0].Enclosure.Url != "http://example.com/1.mp3?a=1&b=2" {
+		t.Errorf("Wrong enclosure url: \n%q\n%q", "http://example.com/1.mp3?a=1&b=2", items[0].Enclosure.Url)
+	}
+	if items[0].Duration != time.Hour+2*time.Minute+3*time.Second {
+		t.Errorf("The itunes namespace was lost: %v", items[0].Duration)
+	}
+	if items[1].Title != "Episode 3 & friends" {
+		t.Errorf("Wrong title of the last item: \n%q\n%q", "Episode 3 & friends", items[1].Title)
+	}
+
+	expected := []string{"not well-formed", "not valid UTF-8", "control characters", "ampersands", "HTML entities", "<item> number 2"}
+	for _, warning := range expected {
+		if !strings.Contains(strings.Join(warnings, "\n"), warning) {
+			t.Errorf("Missing warning about %q: %q", warning, warnings)
+		}
+	}
+}
+
+func TestParseFeedLenientWellFormed(t *testing.T) {
+	rss := Rss{Channel{Title: "Test Podcast", Items: []Item{{Title: "Podcast Item 1"}}}}
+	parsed, warnings, err := ParseFeedLenient(bytes.NewReader([]byte(rss.String())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 0 {
+		t.Errorf("Unexpected warnings for a well-formed feed: %q", warnings)
+	}
+	if len(parsed.Channel.Items) != 1 {
+		t.Errorf("Wrong items: %v", parsed.Channel.Items)
+	}
+}
+
+func TestParseAtomLenient(t *testing.T) {
+	atom := `<feed xmlns="http://www.w3.org/2005/Atom"><title>Atom&nbsp;Cast</title>
+<entry><title>Entry 1</title><link rel="enclosure" href="http://example.com/1.mp3?a=1&b=2"/></entry>
+<entry><title>Entry 2</title><summary><![CDATA[ truncated</summary></entry>
+</feed>`
+
+	rss, warnings, err := ParseFeedLenient(strings.NewReader(atom))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rss.Channel.Title != "Atom Cast" {
+		t.Errorf("Wrong channel title: \n%q\n%q", "Atom Cast", rss.Channel.Title)
+	}
+	if len(rss.Channel.Items) != 1 || rss.Channel.Items[0].Enclosure.Url != "http://example.com/1.mp3?a=1&b=2" {
+		t.Errorf("Wrong items: %v", rss.Channel.Items)
+	}
+	if len(warnings) == 0 {
+		t.Errorf("Expected warnings")
+	}
+}
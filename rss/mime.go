@@ -0,0 +1,158 @@
+package rss
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// mediaType is the file extension and the kind of content of a mime type.
+type mediaType struct {
+	ext   string
+	ctype ContentType
+}
+
+// mimeTypes maps the mime types used for podcasts to their extension.  Mime types are
+// lower case and without parameters.
+var mimeTypes = map[string]mediaType{
+	"audio/mpeg":       {"mp3", audio},
+	"audio/mp3":        {"mp3", audio},
+	"audio/mpeg3":      {"mp3", audio},
+	"audio/x-mpeg":     {"mp3", audio},
+	"audio/x-mp3":      {"mp3", audio},
+	"audio/mpg":        {"mp3", audio},
+	"audio/mp4":        {"m4a", audio},
+	"audio/m4a":        {"m4a", audio},
+	"audio/x-m4a":      {"m4a", audio},
+	"audio/x-m4b":      {"m4b", audio},
+	"audio/aac":        {"aac", audio},
+	"audio/aacp":       {"aac", audio},
+	"audio/x-aac":      {"aac", audio},
+	"audio/ogg":        {"ogg", audio},
+	"audio/vorbis":     {"ogg", audio},
+	"audio/x-ogg":      {"ogg", audio},
+	"application/ogg":  {"ogg", audio},
+	"audio/opus":       {"opus", audio},
+	"audio/flac":       {"flac", audio},
+	"audio/x-flac":     {"flac", audio},
+	"audio/wav":        {"wav", audio},
+	"audio/wave":       {"wav", audio},
+	"audio/x-wav":      {"wav", audio},
+	"audio/webm":       {"weba", audio},
+	"video/mp4":        {"mp4", video},
+	"video/x-m4v":      {"m4v", video},
+	"video/quicktime":  {"mov", video},
+	"video/webm":       {"webm", video},
+	"video/ogg":        {"ogv", video},
+	"video/x-matroska": {"mkv", video},
+	"video/mpeg":       {"mpg", video},
+	"video/x-msvideo":  {"avi", video},
+}
+
+// unknownMedia names the file of an episode whose media type is neither declared by the
+// feed nor implied by its url until the episode is downloaded and its content is known.
+var unknownMedia = mediaType{"bin", unknown}
+
+// extensions maps the file extensions of enclosure urls to the media type.
+var extensions = map[string]mediaType{}
+
+func init() {
+	for _, media := range mimeTypes {
+		extensions[media.ext] = media
+	}
+	// mp4 files of podcasts are as likely to be audio as video, video/mp4 is the
+	// conservative choice as it is what the old mp4 handling did
+	extensions["mp4"] = mediaType{"mp4", video}
+	extensions["mpeg"] = mediaType{"mp3", audio}
+	extensions["oga"] = mediaType{"ogg", audio}
+}
+
+// lookupMimeType returns the media type of a mime type such as "audio/x-m4a; codecs=aac".
+func lookupMimeType(mimeType string) (mediaType, bool) {
+	parsed, _, err := mime.ParseMediaType(strings.TrimSpace(mimeType))
+	if err != nil {
+		return mediaType{}, false
+	}
+	media, ok := mimeTypes[strings.ToLower(parsed)]
+	return media, ok
+}
+
+// lookupUrlExtension returns the media type of the extension of the path of rawUrl.
+func lookupUrlExtension(rawUrl string) (mediaType, bool) {
+	parsed, err := url.Parse(rawUrl)
+	if err != nil {
+		return mediaType{}, false
+	}
+	ext := strings.ToLower(strings.TrimPrefix(path.Ext(parsed.Path), "."))
+	media, ok := extensions[ext]
+	return media, ok
+}
+
+// sniffMimeType detects the mime type of the first bytes of a media file.
+func sniffMimeType(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte("fLaC")):
+		return "audio/flac"
+	case bytes.HasPrefix(data, []byte("OggS")):
+		if bytes.Contains(data, []byte("OpusHead")) {
+			return "audio/opus"
+		}
+		if bytes.Contains(data, []byte("theora")) {
+			return "video/ogg"
+		}
+		return "audio/ogg"
+	case len(data) >= 12 && bytes.Equal(data[4:8], []byte("ftyp")):
+		switch string(data[8:12]) {
+		case "M4A ", "M4B ", "M4P ":
+			return "audio/mp4"
+		case "qt  ":
+			return "video/quicktime"
+		case "M4V ", "M4VH", "M4VP":
+			return "video/x-m4v"
+		}
+		return "video/mp4"
+	case len(data) >= 2 && data[0] == 0xFF && data[1]&0xF6 == 0xF0:
+		// ADTS header of raw AAC
+		return "audio/aac"
+	case len(data) >= 2 && data[0] == 0xFF && data[1]&0xE0 == 0xE0:
+		// MPEG audio frame without an ID3 tag
+		return "audio/mpeg"
+	}
+
+	return http.DetectContentType(data)
+}
+
+// itemMediaType determines the media type of an episode from the types declared by the
+// feed and falls back to the extension of the media url.
+func itemMediaType(podcastItem Item) (mediaType, error) {
+	for _, mimeType := range []string{podcastItem.Enclosure.Type, podcastItem.Media.Type} {
+		if media, ok := lookupMimeType(mimeType); ok {
+			return media, nil
+		}
+	}
+
+	if media, ok := lookupUrlExtension(podcastItem.MediaUrl()); ok {
+		return media, nil
+	}
+
+	return mediaType{}, fmt.Errorf("Unable to figure out the extension of %q with type %q", podcastItem.MediaUrl(), podcastItem.Enclosure.Type)
+}
+
+// contentMediaType determines the media type of a downloaded episode from the
+// Content-Type of the response and, if it is not known, from the first bytes of the data.
+func contentMediaType(contentType string, start []byte) (mediaType, error) {
+	if media, ok := lookupMimeType(contentType); ok {
+		return media, nil
+	}
+
+	sniffed := sniffMimeType(start)
+	if media, ok := lookupMimeType(sniffed); ok {
+		return media, nil
+	}
+
+	return mediaType{}, fmt.Errorf("Unable to figure out the extension, the content looks like %q", sniffed)
+}
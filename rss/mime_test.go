@@ -0,0 +1,87 @@
+package rss
+
+import (
+	"testing"
+)
+
+func TestItemMediaType(t *testing.T) {
+	tests := []struct {
+		enclosureType string
+		url           string
+		expected      mediaType
+	}{
+		{"audio/mpeg", "http://example.org/episode", mediaType{"mp3", audio}},
+		{"audio/mp3", "http://example.org/episode", mediaType{"mp3", audio}},
+		{"audio/x-m4a", "http://example.org/episode", mediaType{"m4a", audio}},
+		{"audio/aac", "http://example.org/episode", mediaType{"aac", audio}},
+		{"audio/ogg; codecs=opus", "http://example.org/episode", mediaType{"ogg", audio}},
+		{"audio/opus", "http://example.org/episode", mediaType{"opus", audio}},
+		{"audio/x-flac", "http://example.org/episode", mediaType{"flac", audio}},
+		{"Audio/MP4", "http://example.org/episode", mediaType{"m4a", audio}},
+		{"video/mp4", "http://example.org/episode", mediaType{"mp4", video}},
+		{"video/quicktime", "http://example.org/episode", mediaType{"mov", video}},
+		{"video/webm", "http://example.org/episode", mediaType{"webm", video}},
+		{"", "http://example.org/episode.m4a?source=rss", mediaType{"m4a", audio}},
+		{"application/octet-stream", "http://example.org/episode.OPUS", mediaType{"opus", audio}},
+		{"binary/octet-stream", "http://example.org/episode.mov", mediaType{"mov", video}},
+	}
+
+	for _, test := range tests {
+		item := Item{Enclosure: Enclosure{Url: test.url, Type: test.enclosureType}}
+		media, err := itemMediaType(item)
+		if err != nil {
+			t.Errorf("Unable to determine the media type of %q %q: %v", test.enclosureType, test.url, err)
+		} else if media != test.expected {
+			t.Errorf("Wrong media type for %q %q: \n%v\n%v", test.enclosureType, test.url, test.expected, media)
+		}
+	}
+
+	if _, err := itemMediaType(Item{Enclosure: Enclosure{Url: "http://example.org/episode", Type: "application/octet-stream"}}); err == nil {
+		t.Error("Expected an error when neither the type nor the url identify the media")
+	}
+}
+
+func TestSniffMimeType(t *testing.T) {
+	tests := map[string]string{
+		"ID3\x03\x00\x00\x00":                      "audio/mpeg",
+		"\xFF\xFB\x90\x64":                         "audio/mpeg",
+		"\xFF\xF1\x50\x80":                         "audio/aac",
+		"fLaC\x00\x00\x00\x22":                     "audio/flac",
+		"OggS\x00\x02\x00\x00\x00\x00OpusHead":     "audio/opus",
+		"OggS\x00\x02\x00\x00\x00\x00\x01vorbis":   "audio/ogg",
+		"\x00\x00\x00\x20ftypM4A \x00\x00\x00\x00": "audio/mp4",
+		"\x00\x00\x00\x14ftypqt  \x00\x00\x00\x00": "video/quicktime",
+		"\x00\x00\x00\x18ftypmp42\x00\x00\x00\x00": "video/mp4",
+	}
+
+	for data, expected := range tests {
+		if sniffed := sniffMimeType([]byte(data)); sniffed != expected {
+			t.Errorf("Wrong mime type sniffed from %q: \n%q\n%q", data, expected, sniffed)
+		}
+	}
+}
+
+func TestContentMediaType(t *testing.T) {
+	tests := []struct {
+		contentType string
+		data        string
+		expected    mediaType
+	}{
+		{"audio/mpeg", "", mediaType{"mp3", audio}},
+		{"application/octet-stream", "fLaC\x00\x00\x00\x22 and the rest of the episode", mediaType{"flac", audio}},
+		{"", "\x00\x00\x00\x18ftypmp42 and the rest of the episode", mediaType{"mp4", video}},
+	}
+
+	for _, test := range tests {
+		media, err := contentMediaType(test.contentType, []byte(test.data))
+		if err != nil {
+			t.Errorf("Unable to determine the media type of %q %q: %v", test.contentType, test.data, err)
+		} else if media != test.expected {
+			t.Errorf("Wrong media type of %q %q: \n%v\n%v", test.contentType, test.data, test.expected, media)
+		}
+	}
+
+	if _, err := contentMediaType("application/octet-stream", []byte("this is not a podcast")); err == nil {
+		t.Errorf("Expected an error for text content")
+	}
+}
@@ -4,6 +4,9 @@ import (
 	"bytes"
 	"encoding/xml"
 	"io"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Rss struct {
@@ -15,17 +18,53 @@ type Channel struct {
 	Description   string `xml:"description"`
 	LastBuildDate string `xml:"lastBuildDate"`
 	Items         []Item `xml:"item"`
+
+	Author           string           `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd author,omitempty"`
+	ItunesCategories []ItunesCategory `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd category,omitempty"`
+	NewFeedUrl       string           `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd new-feed-url,omitempty"`
+}
+
+type ItunesCategory struct {
+	Text          string           `xml:"text,attr"`
+	Subcategories []ItunesCategory `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd category,omitempty"`
 }
 
+// Item is an episode of the feed.  The fields of the itunes namespace are decoded by
+// Item.UnmarshalXML into typed values.
 type Item struct {
 	Title       string    `xml:"title"`
 	Link        string    `xml:"link"`
 	Description string    `xml:"description"`
 	PubDate     string    `xml:"pubDate"`
-	Category    string    `xml:"category"`
+	Categories  []string  `xml:"category"`
 	Guid        string    `xml:"guid"`
 	Enclosure   Enclosure `xml:"enclosure"`
 	Media       Media     `xml:"http://search.yahoo.com/mrss/ content"`
+
+	Duration    time.Duration `xml:"-"`
+	Episode     int           `xml:"-"`
+	Season      int           `xml:"-"`
+	EpisodeType string        `xml:"-"`
+	Explicit    bool          `xml:"-"`
+	Image       string        `xml:"-"`
+	Summary     string        `xml:"-"`
+}
+
+// MediaUrl returns the url of the enclosure or of the media content if there is no enclosure.
+func (item *Item) MediaUrl() string {
+	if item.Enclosure.Url != "" {
+		return item.Enclosure.Url
+	}
+	return item.Media.Url
+}
+
+// Id identifies the item in the download history.  It is the guid of the item or the url
+// of its media if the feed has no guids.
+func (item *Item) Id() string {
+	if item.Guid != "" {
+		return item.Guid
+	}
+	return item.MediaUrl()
 }
 
 type Media struct {
@@ -38,6 +77,15 @@ type Enclosure struct {
 	Length string `xml:"length,attr"`
 }
 
+// length is the Length of the enclosure in bytes or 0 if it is missing or invalid.
+func (enclosure *Enclosure) length() int64 {
+	length, err := strconv.ParseInt(strings.TrimSpace(enclosure.Length), 10, 64)
+	if err != nil || length < 0 {
+		return 0
+	}
+	return length
+}
+
 func (rss *Rss) Write(writer io.Writer) (int, error) {
 	return write(rss, writer)
 }
@@ -0,0 +1,110 @@
+package rss
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DEFAULT_NAMING_TEMPLATE is the layout used when neither the head nor the outline
+// configure a NamingTemplate.
+const DEFAULT_NAMING_TEMPLATE = "{type}/{channel}/{title}.{ext}"
+
+const DEFAULT_PUBDATE_LAYOUT = "2006-01-02"
+
+var (
+	templatePlaceholder = regexp.MustCompile(`\{([a-z]+)(?::([^}]*))?\}`)
+)
+
+// episodeName is the data available to a naming template.
+type episodeName struct {
+	channel *Channel
+	item    *Item
+	ext     string
+	ctype   ContentType
+	mode    FilenameMode
+}
+
+func (name *episodeName) placeholder(key, format string) (string, error) {
+	switch key {
+	case "channel":
+		return name.channel.Title, nil
+	case "title":
+		return name.item.Title, nil
+	case "ext":
+		return name.ext, nil
+	case "type":
+		return string(name.ctype), nil
+	case "pubdate":
+		if format == "" {
+			format = DEFAULT_PUBDATE_LAYOUT
+		}
+		date, err := ParsePubDate(name.item.PubDate)
+		if err != nil {
+			// the episode is still downloaded, the download date is the best guess
+			log.Printf("Using the current date for {pubdate} of %q: %v\n", name.item.Title, err)
+			date = time.Now()
+		}
+		return date.Format(format), nil
+	case "season", "episode":
+		number := name.item.Season
+		if key == "episode" {
+			number = name.item.Episode
+		}
+		width, err := strconv.Atoi("0" + format)
+		if err != nil {
+			return "", fmt.Errorf("Invalid width %q for {%s}", format, key)
+		}
+		return fmt.Sprintf("%0*d", width, number), nil
+	}
+
+	return "", fmt.Errorf("Unknown placeholder {%s}", key)
+}
+
+// ValidateTemplate checks that template is a relative path with known placeholders.
+func ValidateTemplate(template string) error {
+	_, err := expandTemplate(template, &episodeName{channel: &Channel{}, item: &Item{}, mode: POSIX_NAMES})
+	return err
+}
+
+// expandTemplate replaces the placeholders of template with the sanitized values of the
+// episode.  Placeholders are:
+//
+//	{channel} {title} {ext} {type}        channel and episode title, extension, audio or video
+//	{pubdate} {pubdate:<layout>}          publish date formatted with a go time layout
+//	{season} {episode} {episode:<width>}  itunes season and episode, zero padded to width
+//
+// The "/" of the template separates directories, a "/" within a value is replaced.  Names
+// longer than MAX_NAME_BYTES are truncated.
+func expandTemplate(template string, name *episodeName) (string, error) {
+	if template == "" || strings.HasPrefix(template, "/") || filepath.IsAbs(template) {
+		return "", fmt.Errorf("Naming template %q must be a relative path", template)
+	}
+
+	var err error
+	expanded := templatePlaceholder.ReplaceAllStringFunc(template, func(placeholder string) string {
+		match := templatePlaceholder.FindStringSubmatch(placeholder)
+		value, placeholderErr := name.placeholder(match[1], match[2])
+		if placeholderErr != nil && err == nil {
+			err = fmt.Errorf("Naming template %q: %v", template, placeholderErr)
+		}
+		return sanitizeName(value, name.mode)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	segments := strings.Split(expanded, "/")
+	for i, segment := range segments {
+		if segment == "" || segment == "." || segment == ".." {
+			return "", fmt.Errorf("Naming template %q contains an empty, '.' or '..' directory", template)
+		}
+		segments[i] = truncateName(segment, MAX_NAME_BYTES)
+	}
+
+	return filepath.Join(segments...), nil
+}
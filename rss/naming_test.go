@@ -0,0 +1,53 @@
+package rss
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestExpandTemplate(t *testing.T) {
+	channel := &Channel{Title: "Daily Tech News Show"}
+	item := &Item{
+		Title:   "DTNS 2297: Antitrust/Prime",
+		PubDate: "Mon, 11 Aug 2014 21:20:36 +0000",
+		Season:  2,
+		Episode: 7}
+	name := &episodeName{channel, item, "mp3", audio, POSIX_NAMES}
+
+	tests := []struct {
+		template string
+		expected string
+	}{
+		{DEFAULT_NAMING_TEMPLATE, "audio/Daily Tech News Show/DTNS 2297: Antitrust_Prime.mp3"},
+		{"{channel}/{pubdate:2006-01-02} - {season}x{episode:02} - {title}.{ext}", "Daily Tech News Show/2014-08-11 - 2x07 - DTNS 2297: Antitrust_Prime.mp3"},
+		{"{channel}/{pubdate}.{ext}", "Daily Tech News Show/2014-08-11.mp3"},
+		{"{channel}/{pubdate:2006/01}/{title}.{ext}", "Daily Tech News Show/2014_08/DTNS 2297: Antitrust_Prime.mp3"},
+	}
+
+	for _, test := range tests {
+		expanded, err := expandTemplate(test.template, name)
+		if err != nil {
+			t.Errorf("Unable to expand %q: %v", test.template, err)
+			continue
+		}
+		if expanded != filepath.FromSlash(test.expected) {
+			t.Errorf("Wrong expansion of %q: \n%q\n%q", test.template, test.expected, expanded)
+		}
+	}
+}
+
+func TestValidateTemplate(t *testing.T) {
+	valid := []string{DEFAULT_NAMING_TEMPLATE, "{channel}/{episode:03}.{ext}", "podcasts/{title}"}
+	for _, template := range valid {
+		if err := ValidateTemplate(template); err != nil {
+			t.Errorf("Template %q should be valid: %v", template, err)
+		}
+	}
+
+	invalid := []string{"", "/{channel}/{title}.{ext}", "{channel}/../{title}", "{channel}//{title}", "{author}/{title}", "{episode:x}"}
+	for _, template := range invalid {
+		if err := ValidateTemplate(template); err == nil {
+			t.Errorf("Template %q should be invalid", template)
+		}
+	}
+}
@@ -1,11 +1,23 @@
 package rss
 
 import (
+	"bytes"
 	"encoding/xml"
+	"fmt"
+	"gopod/charset"
 	"io"
+	"io/ioutil"
+	"strings"
 )
 
+// ParseRss parses an Rss 2.0 feed.  Feeds that are not UTF-8 are converted by
+// charset.NewReader.
 func ParseRss(reader io.Reader) (*Rss, error) {
+	reader, err := charset.NewReader(reader, "")
+	if err != nil {
+		return nil, err
+	}
+
 	decoder := xml.NewDecoder(reader)
 	var rss Rss
 	if err := decoder.Decode(&rss); err != nil {
@@ -14,3 +26,42 @@ func ParseRss(reader io.Reader) (*Rss, error) {
 
 	return &rss, nil
 }
+
+// rootElement returns the name of the first element of the xml document.
+func rootElement(feedText []byte) (string, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(feedText))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return "", err
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			return start.Name.Local, nil
+		}
+	}
+}
+
+// ParseFeed parses an Rss 2.0 or an Atom feed depending on the root element of the document.
+func ParseFeed(reader io.Reader) (*Rss, error) {
+	feedText, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	if feedText, err = charset.ToUtf8(feedText, ""); err != nil {
+		return nil, err
+	}
+
+	root, err := rootElement(feedText)
+	if err != nil {
+		return nil, err
+	}
+
+	switch strings.ToLower(root) {
+	case "rss":
+		return ParseRss(bytes.NewReader(feedText))
+	case "feed":
+		return ParseAtom(bytes.NewReader(feedText))
+	}
+
+	return nil, fmt.Errorf("Unsupported feed format, the root element is <%s> but must be <rss> or <feed>", root)
+}
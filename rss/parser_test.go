@@ -3,9 +3,11 @@ package rss
 import (
 	"bytes"
 	"io/ioutil"
+	"reflect"
 	"regexp"
 	"strings"
 	"testing"
+	"unicode/utf16"
 )
 
 func TestParseRss(t *testing.T) {
@@ -39,8 +41,9 @@ func TestParseRss(t *testing.T) {
 		Link:        "http://feedproxy.google.com/~r/DailyTechNewsShow/~3/CeBqn9GHRKk/",
 		Description: "Nate Lanxon is on the show today to chat about the Hachette-Amazon spat, as well as a little on Broadwell chips and the $300 million 60 Tb/s cable Google wants to lay. MP3 Multiple versions (ogg, video etc.) from Archive.org. Please SUBSCRIBE HERE. A special thanks to all our Patreon supporters&#8211;without you, none of this [&#8230;]",
 		PubDate:     "Mon, 11 Aug 2014 21:20:36 +0000",
-		Category:    "Episode",
+		Categories:  []string{"Episode"},
 		Guid:        "http://www.dailytechnewsshow.com/?p=1844",
+		Summary:     "Nate Lanxon is on the show today to chat about the Hachette-Amazon spat, as well as a little on Broadwell chips and the $300 million 60 Tb/s cable Google wants to lay. MP3 Multiple versions (ogg, video etc.) from Archive.org. Please SUBSCRIBE HERE. A special thanks to all our Patreon supporters&#8211;without you, none of this [&#8230;]",
 		Enclosure: Enclosure{
 			Url:  "http://archive.org/download/DTNS20140811/DTNS20140811.mp3",
 			Type: "audio/mpeg"},
@@ -52,12 +55,12 @@ func TestParseRss(t *testing.T) {
 func checkItem(t *testing.T, index int, items []Item, expected Item) {
 	actual := items[index]
 
-	if actual != expected {
+	if !reflect.DeepEqual(actual, expected) {
 		if actual.Title != expected.Title {
 			t.Errorf("Item[%d] does not have the correct title: \n%q\n%q", index, expected.Title, actual.Title)
 		}
-		if actual.Category != expected.Category {
-			t.Errorf("Item[%d] does not have the correct category: \n%q\n%q", index, expected.Category, actual.Category)
+		if !reflect.DeepEqual(actual.Categories, expected.Categories) {
+			t.Errorf("Item[%d] does not have the correct categories: \n%q\n%q", index, expected.Categories, actual.Categories)
 		}
 		if actual.Guid != expected.Guid {
 			t.Errorf("Item[%d] does not have the correct Guid: \n%q\n%q", index, expected.Guid, actual.Guid)
@@ -80,12 +83,32 @@ func checkItem(t *testing.T, index int, items []Item, expected Item) {
 		if actual.Enclosure.Type != expected.Enclosure.Type {
 			t.Errorf("Item[%d] does not have the correct Enclosure.Type: \n%q\n%q", index, expected.Enclosure.Type, actual.Enclosure.Type)
 		}
+		if actual.Duration != expected.Duration {
+			t.Errorf("Item[%d] does not have the correct Duration: \n%v\n%v", index, expected.Duration, actual.Duration)
+		}
+		if actual.Episode != expected.Episode || actual.Season != expected.Season {
+			t.Errorf("Item[%d] does not have the correct Season/Episode: \n%d/%d\n%d/%d", index, expected.Season, expected.Episode, actual.Season, actual.Episode)
+		}
+		if actual.EpisodeType != expected.EpisodeType {
+			t.Errorf("Item[%d] does not have the correct EpisodeType: \n%q\n%q", index, expected.EpisodeType, actual.EpisodeType)
+		}
+		if actual.Explicit != expected.Explicit {
+			t.Errorf("Item[%d] does not have the correct Explicit: \n%v\n%v", index, expected.Explicit, actual.Explicit)
+		}
+		if actual.Image != expected.Image {
+			t.Errorf("Item[%d] does not have the correct Image: \n%q\n%q", index, expected.Image, actual.Image)
+		}
 		whiteSpaceMatcher := regexp.MustCompile(`\s+`)
 		actualDesc := string(whiteSpaceMatcher.ReplaceAll([]byte(actual.Description), []byte("")))
 		expectedDesc := string(whiteSpaceMatcher.ReplaceAll([]byte(expected.Description), []byte("")))
 		if actualDesc != expectedDesc {
 			t.Errorf("Item[%d] does not have the correct Description: \n%q\n%q", index, expectedDesc, actualDesc)
 		}
+		actualSummary := string(whiteSpaceMatcher.ReplaceAll([]byte(actual.Summary), []byte("")))
+		expectedSummary := string(whiteSpaceMatcher.ReplaceAll([]byte(expected.Summary), []byte("")))
+		if actualSummary != expectedSummary {
+			t.Errorf("Item[%d] does not have the correct Summary: \n%q\n%q", index, expectedSummary, actualSummary)
+		}
 	}
 }
 
@@ -101,7 +124,7 @@ func Test_WriteReadCycle(t *testing.T) {
 					Link:        "http://item.link",
 					Description: "ItemDescription",
 					PubDate:     "Mon, 11 Aug 2014 21:20:36 +0000",
-					Category:    "tech",
+					Categories:  []string{"tech", "news"},
 					Guid:        "guid"}}}}
 
 	parsed, err := ParseRss(strings.NewReader(original.String()))
@@ -126,3 +149,29 @@ func Test_WriteReadCycle(t *testing.T) {
 		checkItem(t, i, parsed.Channel.Items, item)
 	}
 }
+
+func TestParseFeedCharsets(t *testing.T) {
+	latin1Rss := "<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?>\n<rss><channel><title>Caf\xe9 M\xfcnchen</title>" +
+		"<item><title>\x93Episode\x94 1</title></item></channel></rss>"
+	latin1Atom := "<?xml version=\"1.0\" encoding=\"windows-1252\"?>\n<feed xmlns=\"http://www.w3.org/2005/Atom\"><title>Caf\xe9 M\xfcnchen</title>" +
+		"<entry><title>\x93Episode\x94 1</title></entry></feed>"
+
+	utf16Rss := []byte{0xFF, 0xFE}
+	for _, unit := range utf16.Encode([]rune(`<?xml version="1.0" encoding="UTF-16"?><rss><channel><title>Café München</title><item><title>“Episode” 1</title></item></channel></rss>`)) {
+		utf16Rss = append(utf16Rss, byte(unit), byte(unit>>8))
+	}
+
+	for name, data := range map[string][]byte{"latin1 rss": []byte(latin1Rss), "windows-1252 atom": []byte(latin1Atom), "utf-16 rss": utf16Rss} {
+		rss, err := ParseFeed(bytes.NewReader(data))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if rss.Channel.Title != "Café München" {
+			t.Errorf("%s: wrong channel title: \n%q\n%q", name, "Café München", rss.Channel.Title)
+		}
+		if len(rss.Channel.Items) != 1 || rss.Channel.Items[0].Title != "“Episode” 1" {
+			t.Errorf("%s: wrong items: %v", name, rss.Channel.Items)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package rss
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// rfc822Date matches the dates of Rss feeds in the many variants found in real feeds:
+	// optional weekday, one or two digit days, full month names, two digit years, missing
+	// seconds and numeric or named zones.  Anything after the zone is ignored.
+	rfc822Date = regexp.MustCompile(`^(?:[A-Za-z]+\.?,?\s*)?(\d{1,2})(?:st|nd|rd|th)?[\s-]+([A-Za-z]+)\.?[\s-]+(\d{2}|\d{4}),?\s+(\d{1,2}):(\d{2})(?::(\d{2}))?(?:\.\d+)?\s*([+-]\d{2}:?\d{2}|[A-Za-z]{1,5}\b)?`)
+
+	isoLayouts = []string{
+		time.RFC3339Nano,
+		"2006-01-02T15:04:05Z0700",
+		"2006-01-02T15:04Z07:00",
+		"2006-01-02 15:04:05Z07:00",
+		"2006-01-02 15:04:05 -0700",
+		"2006-01-02T15:04:05",
+		"2006-01-02 15:04:05",
+		"2006-01-02T15:04",
+		"2006-01-02",
+	}
+
+	// otherLayouts are tried last for dates that are not in the Rss or ISO format
+	otherLayouts = []string{time.UnixDate, time.RubyDate, time.ANSIC, "January 2, 2006", "Jan 2, 2006", "January 2 2006"}
+)
+
+var months = map[string]time.Month{
+	"jan": time.January, "feb": time.February, "mar": time.March, "apr": time.April,
+	"may": time.May, "jun": time.June, "jul": time.July, "aug": time.August,
+	"sep": time.September, "oct": time.October, "nov": time.November, "dec": time.December,
+}
+
+// zones are the offsets in hours of the named zones of RFC 822 and of the ones commonly
+// used in feeds.  Dates with other names are invalid rather than guessed to be UTC.
+var zones = map[string]int{
+	"UT": 0, "UTC": 0, "GMT": 0, "Z": 0,
+	"EST": -5, "EDT": -4, "CST": -6, "CDT": -5, "MST": -7, "MDT": -6, "PST": -8, "PDT": -7,
+	"AKST": -9, "AKDT": -8, "HST": -10,
+	"WET": 0, "BST": 1, "WEST": 1, "CET": 1, "CEST": 2, "MET": 1, "MEST": 2, "EET": 2, "EEST": 3,
+	"JST": 9, "AEST": 10, "AEDT": 11, "NZST": 12, "NZDT": 13,
+}
+
+// ParsePubDate parses the pubDate of an item.  Besides RFC 822 and RFC 1123 dates it
+// accepts the common mistakes of feeds: single digit days, missing seconds, named zones,
+// two digit years, ISO 8601 dates and trailing garbage.  Dates without a zone are UTC.
+func ParsePubDate(pubDate string) (time.Time, error) {
+	value := strings.Join(strings.Fields(pubDate), " ")
+	if value == "" {
+		return time.Time{}, fmt.Errorf("The date is empty")
+	}
+
+	if date, ok := parseRfc822Date(value); ok {
+		return date, nil
+	}
+
+	// an ISO date has as many words as its layout, words after it are garbage
+	words := strings.Split(value, " ")
+	for _, layout := range isoLayouts {
+		length := strings.Count(layout, " ") + 1
+		if length > len(words) {
+			continue
+		}
+		candidate := strings.Join(words[:length], " ")
+		if date, err := time.Parse(layout, candidate); err == nil {
+			return date, nil
+		}
+	}
+
+	for _, layout := range otherLayouts {
+		if date, err := time.Parse(layout, value); err == nil {
+			return date, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("Unable to parse the date %q", pubDate)
+}
+
+func parseRfc822Date(value string) (time.Time, bool) {
+	match := rfc822Date.FindStringSubmatch(value)
+	if match == nil {
+		return time.Time{}, false
+	}
+
+	day, _ := strconv.Atoi(match[1])
+	monthName := strings.ToLower(match[2])
+	if len(monthName) < 3 {
+		return time.Time{}, false
+	}
+	month, ok := months[monthName[:3]]
+	if !ok {
+		return time.Time{}, false
+	}
+
+	year, _ := strconv.Atoi(match[3])
+	if len(match[3]) == 2 {
+		// RFC 2822: 00 to 49 are 2000 to 2049, 50 to 99 are 1950 to 1999
+		if year < 50 {
+			year += 2000
+		} else {
+			year += 1900
+		}
+	}
+
+	hour, _ := strconv.Atoi(match[4])
+	minute, _ := strconv.Atoi(match[5])
+	second := 0
+	if match[6] != "" {
+		second, _ = strconv.Atoi(match[6])
+	}
+	if hour > 23 || minute > 59 || second > 60 {
+		return time.Time{}, false
+	}
+
+	location, ok := parseZone(match[7])
+	if !ok {
+		return time.Time{}, false
+	}
+
+	date := time.Date(year, month, day, hour, minute, second, 0, location)
+	// time.Date normalizes days that do not exist such as the 31st of June
+	if date.Day() != day {
+		return time.Time{}, false
+	}
+	return date, true
+}
+
+func parseZone(zone string) (*time.Location, bool) {
+	if zone == "" {
+		return time.UTC, true
+	}
+
+	if zone[0] == '+' || zone[0] == '-' {
+		digits := strings.Replace(zone[1:], ":", "", 1)
+		hours, _ := strconv.Atoi(digits[:2])
+		minutes, _ := strconv.Atoi(digits[2:])
+		if hours > 23 || minutes > 59 {
+			return nil, false
+		}
+		offset := hours*3600 + minutes*60
+		if zone[0] == '-' {
+			offset = -offset
+		}
+		return time.FixedZone("", offset), true
+	}
+
+	name := strings.ToUpper(zone)
+	offset, ok := zones[name]
+	if !ok {
+		return nil, false
+	}
+	return time.FixedZone(name, offset*3600), true
+}
@@ -0,0 +1,82 @@
+package rss
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParsePubDate(t *testing.T) {
+	utc := func(year int, month time.Month, day, hour, minute, second int) time.Time {
+		return time.Date(year, month, day, hour, minute, second, 0, time.UTC)
+	}
+
+	tests := []struct {
+		pubDate  string
+		expected time.Time
+	}{
+		{"Mon, 11 Aug 2014 21:20:36 +0000", utc(2014, time.August, 11, 21, 20, 36)},
+		{"Mon, 11 Aug 2014 21:20:36 GMT", utc(2014, time.August, 11, 21, 20, 36)},
+		{"Tue, 5 Aug 2014 21:20:36 +0000", utc(2014, time.August, 5, 21, 20, 36)},
+		{"Tue, 05 Aug 2014 21:20 +0000", utc(2014, time.August, 5, 21, 20, 0)},
+		{"Mon, 11 Aug 2014 14:20:36 PDT", utc(2014, time.August, 11, 21, 20, 36)},
+		{"Mon, 11 Aug 2014 13:20:36 PST", utc(2014, time.August, 11, 21, 20, 36)},
+		{"Mon, 11 Aug 2014 17:20:36 EDT", utc(2014, time.August, 11, 21, 20, 36)},
+		{"Mon, 11 Aug 2014 23:20:36 CEST", utc(2014, time.August, 11, 21, 20, 36)},
+		{"Mon, 11 Aug 2014 23:20:36 +02:00", utc(2014, time.August, 11, 21, 20, 36)},
+		{"Mon, 11 Aug 2014 21:20:36 -0000", utc(2014, time.August, 11, 21, 20, 36)},
+		{"Mon, 11 Aug 14 21:20:36 +0000", utc(2014, time.August, 11, 21, 20, 36)},
+		{"Thu, 11 Aug 94 21:20:36 +0000", utc(1994, time.August, 11, 21, 20, 36)},
+		{"Monday, 11 August 2014 21:20:36 +0000", utc(2014, time.August, 11, 21, 20, 36)},
+		{"Mon, 11 Sept 2014 21:20:36 +0000", utc(2014, time.September, 11, 21, 20, 36)},
+		{"11 Aug 2014 21:20:36 +0000", utc(2014, time.August, 11, 21, 20, 36)},
+		{"Mon,11 Aug 2014 21:20:36 +0000", utc(2014, time.August, 11, 21, 20, 36)},
+		{"  Mon, 11  Aug 2014   21:20:36 +0000\n", utc(2014, time.August, 11, 21, 20, 36)},
+		{"Mon, 11 Aug 2014 21:20:36", utc(2014, time.August, 11, 21, 20, 36)},
+		{"Mon, 11 Aug 2014 21:20:36 +0000 (UTC)", utc(2014, time.August, 11, 21, 20, 36)},
+		{"Mon, 11 Aug 2014 21:20:36 GMT+0000 garbage", utc(2014, time.August, 11, 21, 20, 36)},
+		{"Tue, 11 Aug 2014 21:20:36 +0000", utc(2014, time.August, 11, 21, 20, 36)},
+		{"11-Aug-2014 21:20:36 +0000", utc(2014, time.August, 11, 21, 20, 36)},
+		{"2014-08-11T21:20:36Z", utc(2014, time.August, 11, 21, 20, 36)},
+		{"2014-08-11T23:20:36+02:00", utc(2014, time.August, 11, 21, 20, 36)},
+		{"2014-08-11T21:20:36.123Z", time.Date(2014, time.August, 11, 21, 20, 36, 123000000, time.UTC)},
+		{"2014-08-11T23:20:36+0200", utc(2014, time.August, 11, 21, 20, 36)},
+		{"2014-08-11 21:20:36", utc(2014, time.August, 11, 21, 20, 36)},
+		{"2014-08-11", utc(2014, time.August, 11, 0, 0, 0)},
+		{"2014-08-11T21:20:36Z updated", utc(2014, time.August, 11, 21, 20, 36)},
+		{"2024-01-02T10:00:00 garbage", utc(2024, time.January, 2, 10, 0, 0)},
+		{"2024-01-02 garbage", utc(2024, time.January, 2, 0, 0, 0)},
+		{"2024-01-02T10:00 (UTC)", utc(2024, time.January, 2, 10, 0, 0)},
+		{"2024-01-02 10:00:00 +0100 garbage", utc(2024, time.January, 2, 9, 0, 0)},
+		{"Mon Aug 11 21:20:36 UTC 2014", utc(2014, time.August, 11, 21, 20, 36)},
+		{"August 11, 2014", utc(2014, time.August, 11, 0, 0, 0)},
+	}
+
+	for _, test := range tests {
+		actual, err := ParsePubDate(test.pubDate)
+		if err != nil {
+			t.Errorf("%q: %v", test.pubDate, err)
+			continue
+		}
+		if !actual.Equal(test.expected) {
+			t.Errorf("%q: \n%v\n%v", test.pubDate, test.expected, actual.UTC())
+		}
+	}
+}
+
+func TestParsePubDateErrors(t *testing.T) {
+	for _, pubDate := range []string{
+		"",
+		"   ",
+		"yesterday",
+		"Mon, 31 Jun 2014 21:20:36 +0000",
+		"Mon, 11 Foo 2014 21:20:36 +0000",
+		"Mon, 11 Aug 2014 25:20:36 +0000",
+		"Mon, 11 Aug 2014 21:20:36 XYZ",
+		"Mon, 11 Aug 2014 21:20:36 PTS",
+		"11/08/2014",
+	} {
+		if date, err := ParsePubDate(pubDate); err == nil {
+			t.Errorf("Expected an error for %q but got %v", pubDate, date)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package rss
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// FilenameMode selects the characters that are allowed in file names.
+type FilenameMode string
+
+const (
+	// POSIX_NAMES only replaces "/" and control characters.
+	POSIX_NAMES FilenameMode = "posix"
+	// FAT_NAMES also replaces the characters and names that FAT and exFAT file systems,
+	// as used by most USB players, do not allow.
+	FAT_NAMES FilenameMode = "fat"
+
+	// MAX_NAME_BYTES is the maximum length of a file or directory name.
+	MAX_NAME_BYTES = 255
+)
+
+const fatIllegalChars = `<>:"\|?*`
+
+var fatReservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// ParseFilenameMode returns the FilenameMode named mode, "" is POSIX_NAMES.
+func ParseFilenameMode(mode string) (FilenameMode, error) {
+	switch FilenameMode(strings.ToLower(strings.TrimSpace(mode))) {
+	case "", POSIX_NAMES:
+		return POSIX_NAMES, nil
+	case FAT_NAMES:
+		return FAT_NAMES, nil
+	}
+	return "", fmt.Errorf("Unknown FilenameMode %q, expected %q or %q", mode, POSIX_NAMES, FAT_NAMES)
+}
+
+// sanitizeName makes a value usable as (part of) a file name.  Letters of all scripts are
+// kept, only characters that are illegal in mode are replaced by "_".  The result never
+// contains a path separator and is never "", "." or "..".
+func sanitizeName(name string, mode FilenameMode) string {
+	cleaned := strings.Map(func(r rune) rune {
+		switch {
+		case r == '/' || r == utf8.RuneError || unicode.IsControl(r):
+			return '_'
+		case mode == FAT_NAMES && strings.ContainsRune(fatIllegalChars, r):
+			return '_'
+		}
+		return r
+	}, name)
+
+	cleaned = strings.TrimSpace(cleaned)
+	if mode == FAT_NAMES {
+		// FAT silently drops trailing dots and spaces which would create collisions
+		cleaned = strings.TrimRight(cleaned, ". ")
+		base := cleaned
+		if dot := strings.Index(base, "."); dot >= 0 {
+			base = base[:dot]
+		}
+		if fatReservedNames[strings.ToUpper(base)] {
+			cleaned = "_" + cleaned
+		}
+	}
+
+	if strings.Trim(cleaned, ".") == "" {
+		cleaned = strings.Replace(cleaned, ".", "_", -1) + "_"
+	}
+	return cleaned
+}
+
+// truncateName shortens name to at most maxBytes bytes without splitting a character.
+// The extension is kept if it is reasonably short.
+func truncateName(name string, maxBytes int) string {
+	if len(name) <= maxBytes {
+		return name
+	}
+
+	ext := filepath.Ext(name)
+	if len(ext) > 16 || len(ext) >= maxBytes {
+		ext = ""
+	}
+	base := name[:len(name)-len(ext)]
+	limit := maxBytes - len(ext)
+	for limit > 0 && !utf8.RuneStart(base[limit]) {
+		limit--
+	}
+
+	return strings.TrimSpace(base[:limit]) + ext
+}
+
+// disambiguateName returns path with a suffix derived from id inserted before the
+// extension.  The suffix only depends on id so the same episode always gets the same name.
+func disambiguateName(path, id string) string {
+	suffix := " [" + fmt.Sprintf("%x", sha1.Sum([]byte(id)))[:8] + "]"
+	dir, file := filepath.Split(path)
+	ext := filepath.Ext(file)
+	base := truncateName(file[:len(file)-len(ext)], MAX_NAME_BYTES-len(ext)-len(suffix))
+	return filepath.Join(dir, base+suffix+ext)
+}
@@ -0,0 +1,81 @@
+package rss
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSanitizeName(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     FilenameMode
+		expected string
+	}{
+		{"Test Podcast", POSIX_NAMES, "Test Podcast"},
+		{"Süddeutsche Zeitung: Auf den Punkt", POSIX_NAMES, "Süddeutsche Zeitung: Auf den Punkt"},
+		{"Süddeutsche Zeitung: Auf den Punkt", FAT_NAMES, "Süddeutsche Zeitung_ Auf den Punkt"},
+		{"ゆる言語学ラジオ #12", POSIX_NAMES, "ゆる言語学ラジオ #12"},
+		{"Qu'est-ce que c'est ? L'été", FAT_NAMES, "Qu'est-ce que c'est _ L'été"},
+		{"a/b\\c", POSIX_NAMES, "a_b\\c"},
+		{"a/b\\c", FAT_NAMES, "a_b_c"},
+		{"line\nbreak\x00", POSIX_NAMES, "line_break_"},
+		{"Ends with dots...", FAT_NAMES, "Ends with dots"},
+		{"con", FAT_NAMES, "_con"},
+		{"LPT1.mp3", FAT_NAMES, "_LPT1.mp3"},
+		{"con", POSIX_NAMES, "con"},
+		{"..", POSIX_NAMES, "___"},
+		{"", POSIX_NAMES, "_"},
+	}
+	for _, test := range tests {
+		if sanitized := sanitizeName(test.name, test.mode); sanitized != test.expected {
+			t.Errorf("sanitizeName(%q, %s) = %q but expected %q", test.name, test.mode, sanitized, test.expected)
+		}
+	}
+}
+
+func TestTruncateName(t *testing.T) {
+	name := strings.Repeat("日本語", 40) + ".mp3"
+	truncated := truncateName(name, MAX_NAME_BYTES)
+
+	if len(truncated) > MAX_NAME_BYTES {
+		t.Errorf("Name is longer than %d bytes: %d", MAX_NAME_BYTES, len(truncated))
+	}
+	if !utf8.ValidString(truncated) {
+		t.Errorf("Truncation split a character: %q", truncated)
+	}
+	if filepath.Ext(truncated) != ".mp3" {
+		t.Errorf("Truncation removed the extension: %q", truncated)
+	}
+	if truncateName("short.mp3", MAX_NAME_BYTES) != "short.mp3" {
+		t.Error("Short names should not be changed")
+	}
+}
+
+func TestDisambiguateName(t *testing.T) {
+	path := filepath.Join("podcasts", "Show", "Episode.mp3")
+
+	first := disambiguateName(path, "guid-1")
+	if first != disambiguateName(path, "guid-1") {
+		t.Error("Disambiguation must be deterministic")
+	}
+	if first == disambiguateName(path, "guid-2") || first == path {
+		t.Errorf("Different episodes must get different names: %q", first)
+	}
+	if filepath.Dir(first) != filepath.Dir(path) || filepath.Ext(first) != ".mp3" {
+		t.Errorf("Disambiguation must keep the directory and extension: %q", first)
+	}
+}
+
+func TestParseFilenameMode(t *testing.T) {
+	if mode, err := ParseFilenameMode(""); err != nil || mode != POSIX_NAMES {
+		t.Errorf("The default mode should be posix: %q, %v", mode, err)
+	}
+	if mode, err := ParseFilenameMode("FAT"); err != nil || mode != FAT_NAMES {
+		t.Errorf("Expected fat mode: %q, %v", mode, err)
+	}
+	if _, err := ParseFilenameMode("ntfs"); err == nil {
+		t.Error("Expected an error for an unknown mode")
+	}
+}
@@ -0,0 +1,90 @@
+package rss
+
+import (
+	"gopod/opml"
+	"net/url"
+	"sync"
+)
+
+const (
+	DEFAULT_MAX_DOWNLOADS          = 4
+	DEFAULT_MAX_DOWNLOADS_PER_HOST = 2
+)
+
+// Scheduler limits the number of feed fetches and episode downloads that run at the same
+// time, both in total and per host.  A nil *Scheduler does not limit anything.
+type Scheduler struct {
+	slots      chan struct{}
+	maxPerHost int
+
+	mutex sync.Mutex
+	hosts map[string]chan struct{}
+}
+
+func NewScheduler(maxDownloads, maxPerHost int) *Scheduler {
+	if maxDownloads <= 0 {
+		maxDownloads = DEFAULT_MAX_DOWNLOADS
+	}
+	if maxPerHost <= 0 || maxPerHost > maxDownloads {
+		maxPerHost = maxDownloads
+	}
+
+	return &Scheduler{
+		slots:      make(chan struct{}, maxDownloads),
+		maxPerHost: maxPerHost,
+		hosts:      make(map[string]chan struct{})}
+}
+
+// NewSchedulerFromHead creates a Scheduler with the limits configured in the head of the
+// config file.
+func NewSchedulerFromHead(head opml.OpmlHead) *Scheduler {
+	maxPerHost := head.MaxDownloadsPerHost
+	if maxPerHost == 0 {
+		maxPerHost = DEFAULT_MAX_DOWNLOADS_PER_HOST
+	}
+	return NewScheduler(head.MaxDownloads, maxPerHost)
+}
+
+// MaxDownloads is the number of requests that may run at the same time.
+func (scheduler *Scheduler) MaxDownloads() int {
+	if scheduler == nil {
+		return 0
+	}
+	return cap(scheduler.slots)
+}
+
+func (scheduler *Scheduler) hostSlots(rawUrl string) chan struct{} {
+	host := rawUrl
+	if parsed, err := url.Parse(rawUrl); err == nil && parsed.Host != "" {
+		host = parsed.Host
+	}
+
+	scheduler.mutex.Lock()
+	defer scheduler.mutex.Unlock()
+
+	slots, ok := scheduler.hosts[host]
+	if !ok {
+		slots = make(chan struct{}, scheduler.maxPerHost)
+		scheduler.hosts[host] = slots
+	}
+	return slots
+}
+
+// Acquire blocks until a request to rawUrl may start.  The returned function must be
+// called once the request is finished.
+func (scheduler *Scheduler) Acquire(rawUrl string) (release func()) {
+	if scheduler == nil {
+		return func() {}
+	}
+
+	// the host slot is taken first so requests waiting on a busy host do not hold on to
+	// a global slot that a request to a different host could use.
+	hostSlots := scheduler.hostSlots(rawUrl)
+	hostSlots <- struct{}{}
+	scheduler.slots <- struct{}{}
+
+	return func() {
+		<-scheduler.slots
+		<-hostSlots
+	}
+}
@@ -0,0 +1,72 @@
+package rss
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func runScheduled(scheduler *Scheduler, urls []string) (maxRunning int, maxRunningPerHost map[string]int) {
+	var mutex sync.Mutex
+	running := 0
+	runningPerHost := map[string]int{}
+	maxRunningPerHost = map[string]int{}
+
+	var wait sync.WaitGroup
+	for _, url := range urls {
+		wait.Add(1)
+		go func(url string) {
+			defer wait.Done()
+			release := scheduler.Acquire("http://" + url + "/episode.mp3")
+			defer release()
+
+			mutex.Lock()
+			running++
+			runningPerHost[url]++
+			if running > maxRunning {
+				maxRunning = running
+			}
+			if runningPerHost[url] > maxRunningPerHost[url] {
+				maxRunningPerHost[url] = runningPerHost[url]
+			}
+			mutex.Unlock()
+
+			time.Sleep(5 * time.Millisecond)
+
+			mutex.Lock()
+			running--
+			runningPerHost[url]--
+			mutex.Unlock()
+		}(url)
+	}
+	wait.Wait()
+
+	return maxRunning, maxRunningPerHost
+}
+
+func Test_SchedulerLimitsDownloads(t *testing.T) {
+	urls := []string{"a", "a", "a", "a", "a", "b", "b", "b", "c", "c", "d", "e"}
+	maxRunning, maxRunningPerHost := runScheduled(NewScheduler(3, 2), urls)
+
+	if maxRunning > 3 {
+		t.Errorf("Expected at most 3 concurrent downloads but got %d", maxRunning)
+	}
+	for host, max := range maxRunningPerHost {
+		if max > 2 {
+			t.Errorf("Expected at most 2 concurrent downloads from %s but got %d", host, max)
+		}
+	}
+}
+
+func Test_SchedulerDefaults(t *testing.T) {
+	scheduler := NewScheduler(0, 10)
+	if scheduler.MaxDownloads() != DEFAULT_MAX_DOWNLOADS {
+		t.Errorf("Wrong default for MaxDownloads: %d", scheduler.MaxDownloads())
+	}
+	if scheduler.maxPerHost != DEFAULT_MAX_DOWNLOADS {
+		t.Errorf("The per host limit should not exceed MaxDownloads: %d", scheduler.maxPerHost)
+	}
+
+	var unlimited *Scheduler
+	unlimited.Acquire("http://a/episode.mp3")()
+}
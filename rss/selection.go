@@ -0,0 +1,58 @@
+package rss
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// datedItem is an item of the feed with its parsed publish date and its position in the
+// feed.
+type datedItem struct {
+	item     Item
+	date     time.Time
+	dated    bool
+	position int
+}
+
+// selectEpisodes returns the keep newest items of the feed that have media, newest first.
+// Feeds list their items newest or oldest first, so the items are ordered by their publish
+// date.  Items with the same date keep the order of the feed and items whose date cannot
+// be parsed come after the dated ones.  Feeds with fewer items than keep return all of
+// them.  Items the filter excludes do not count towards keep, the ones newer than the oldest
+// selected item are returned as skipped.  The warnings describe the items that were skipped
+// for lack of media or could not be ordered.
+func selectEpisodes(items []Item, keep int, f *filter) (selected []Item, skipped []Skipped, warnings []string) {
+	dated := []datedItem{}
+	for i, item := range items {
+		if item.MediaUrl() == "" {
+			warnings = append(warnings, fmt.Sprintf("Skipped item %q without an enclosure", item.Title))
+			continue
+		}
+
+		date, err := ParsePubDate(item.PubDate)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("Item %q is ordered after the dated items: %v", item.Title, err))
+		}
+		dated = append(dated, datedItem{item, date, err == nil, i})
+	}
+
+	sort.SliceStable(dated, func(i, j int) bool {
+		if dated[i].dated != dated[j].dated {
+			return dated[i].dated
+		}
+		return dated[i].date.After(dated[j].date)
+	})
+
+	for _, episode := range dated {
+		if len(selected) >= keep {
+			break
+		}
+		if reason := f.exclude(episode.item); reason != "" {
+			skipped = append(skipped, Skipped{episode.item.Title, reason})
+			continue
+		}
+		selected = append(selected, episode.item)
+	}
+	return selected, skipped, warnings
+}
@@ -0,0 +1,48 @@
+package rss
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSelectEpisodes(t *testing.T) {
+	item := func(title, pubDate string) Item {
+		return Item{Title: title, PubDate: pubDate, Enclosure: Enclosure{Url: "http://example.com/" + title + ".mp3"}}
+	}
+	jan := item("jan", "Wed, 01 Jan 2014 10:00:00 +0000")
+	feb := item("feb", "Sat, 01 Feb 2014 10:00:00 +0000")
+	mar := item("mar", "Sat, 01 Mar 2014 10:00:00 +0000")
+	marToo := item("marToo", "Sat, 01 Mar 2014 11:00:00 +0100")
+	undated := item("undated", "")
+	noMedia := Item{Title: "noMedia", PubDate: "Tue, 01 Apr 2014 10:00:00 +0000"}
+
+	tests := []struct {
+		name     string
+		items    []Item
+		keep     int
+		expected []string
+		warnings int
+	}{
+		{"newest first", []Item{mar, feb, jan}, 2, []string{"mar", "feb"}, 0},
+		{"oldest first", []Item{jan, feb, mar}, 2, []string{"mar", "feb"}, 0},
+		{"short feed", []Item{jan, feb}, 5, []string{"feb", "jan"}, 0},
+		{"same date keeps feed order", []Item{marToo, jan, mar}, 2, []string{"marToo", "mar"}, 0},
+		{"undated last", []Item{undated, jan, feb}, 3, []string{"feb", "jan", "undated"}, 1},
+		{"skip items without media", []Item{noMedia, jan}, 1, []string{"jan"}, 1},
+		{"empty feed", nil, 1, nil, 0},
+	}
+
+	for _, test := range tests {
+		selected, _, warnings := selectEpisodes(test.items, test.keep, &filter{})
+		var titles []string
+		for _, item := range selected {
+			titles = append(titles, item.Title)
+		}
+		if !reflect.DeepEqual(test.expected, titles) {
+			t.Errorf("Wrong episodes selected for %s: \n%q\n%q", test.name, test.expected, titles)
+		}
+		if len(warnings) != test.warnings {
+			t.Errorf("Wrong number of warnings for %s: \n%d\n%q", test.name, test.warnings, warnings)
+		}
+	}
+}